@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// AnthropicProvider talks to Claude via the Anthropic API or Vertex AI
+type AnthropicProvider struct {
+	client anthropic.Client
+	model  string
+}
+
+// NewAnthropicProvider creates a provider for the api_key or vertex auth types
+func NewAnthropicProvider(ctx context.Context, pc ProviderConfig) (*AnthropicProvider, error) {
+	client, err := CreateClient(ctx, pc)
+	if err != nil {
+		return nil, err
+	}
+
+	model := pc.Model
+	if model == "" {
+		model = ModelForAuth(pc.AuthType)
+	}
+
+	return &AnthropicProvider{client: client, model: model}, nil
+}
+
+// Name returns the provider type
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+// DefaultModel returns the configured model
+func (p *AnthropicProvider) DefaultModel() string {
+	return p.model
+}
+
+// Complete sends a streaming Messages API request
+func (p *AnthropicProvider) Complete(ctx context.Context, req CompletionRequest, onText func(string)) (*CompletionResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.model
+	}
+
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(model),
+		MaxTokens: req.MaxTokens,
+		Messages:  anthropicMessages(req.Messages),
+		Tools:     anthropicTools(req.Tools),
+	}
+	if req.System != "" {
+		params.System = []anthropic.TextBlockParam{{Text: req.System}}
+	}
+	if req.Temperature != nil {
+		params.Temperature = anthropic.Float(*req.Temperature)
+	}
+
+	stream := p.client.Messages.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	var message anthropic.Message
+	var err error
+	for stream.Next() {
+		event := stream.Current()
+		if err = message.Accumulate(event); err != nil {
+			break
+		}
+
+		if onText != nil && event.Type == "content_block_delta" && event.Delta.Type == "text_delta" {
+			onText(event.Delta.Text)
+		}
+	}
+	if err == nil {
+		err = stream.Err()
+	}
+
+	return anthropicResponse(message), err
+}
+
+// anthropicMessages converts neutral messages to API params
+func anthropicMessages(messages []Message) []anthropic.MessageParam {
+	var params []anthropic.MessageParam
+	for _, msg := range messages {
+		var blocks []anthropic.ContentBlockParamUnion
+		for _, block := range msg.Content {
+			switch block.Type {
+			case BlockText:
+				blocks = append(blocks, anthropic.NewTextBlock(block.Text))
+			case BlockToolUse:
+				input := block.Input
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropic.NewToolUseBlock(block.ToolID, input, block.ToolName))
+			case BlockToolResult:
+				blocks = append(blocks, anthropic.NewToolResultBlock(block.ToolID, block.Text, block.IsError))
+			}
+		}
+
+		if msg.Role == RoleAssistant {
+			params = append(params, anthropic.NewAssistantMessage(blocks...))
+		} else {
+			params = append(params, anthropic.NewUserMessage(blocks...))
+		}
+	}
+	return params
+}
+
+// anthropicTools converts neutral tool definitions to API params
+func anthropicTools(tools []ToolDef) []anthropic.ToolUnionParam {
+	var params []anthropic.ToolUnionParam
+	for _, def := range tools {
+		tool := anthropic.ToolUnionParamOfTool(
+			anthropic.ToolInputSchemaParam{
+				Properties: def.Properties,
+				Required:   def.Required,
+			},
+			def.Name,
+		)
+		tool.OfTool.Description = anthropic.String(def.Description)
+		params = append(params, tool)
+	}
+	return params
+}
+
+// anthropicResponse converts an accumulated API message to a neutral response
+func anthropicResponse(message anthropic.Message) *CompletionResponse {
+	resp := &CompletionResponse{
+		StopReason: string(message.StopReason),
+		Usage: TokenUsage{
+			InputTokens:         message.Usage.InputTokens,
+			OutputTokens:        message.Usage.OutputTokens,
+			CacheCreationTokens: message.Usage.CacheCreationInputTokens,
+			CacheReadTokens:     message.Usage.CacheReadInputTokens,
+		},
+	}
+
+	for _, block := range message.Content {
+		switch block.Type {
+		case "text":
+			resp.Content = append(resp.Content, ContentBlock{Type: BlockText, Text: block.Text})
+		case "tool_use":
+			resp.Content = append(resp.Content, ContentBlock{
+				Type:     BlockToolUse,
+				ToolID:   block.ID,
+				ToolName: block.Name,
+				Input:    block.Input,
+			})
+		}
+	}
+
+	return resp
+}
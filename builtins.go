@@ -29,7 +29,8 @@ func getBuiltinCommands() (map[string]Command, error) {
 			continue
 		}
 
-		cmd.Source = "built-in"
+		cmd.Name = name
+		cmd.Source = BuiltinSource
 		commands[name] = cmd
 	}
 
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ChatMessage is a single turn in a chat session
+type ChatMessage struct {
+	Role    string `json:"role"` // "user" or "assistant"
+	Content string `json:"content"`
+}
+
+// ChatSession is a persisted multi-turn conversation
+type ChatSession struct {
+	ID       string        `json:"id"`
+	Model    string        `json:"model"`
+	Created  time.Time     `json:"created"`
+	Updated  time.Time     `json:"updated"`
+	Messages []ChatMessage `json:"messages"`
+}
+
+// chatSystemPrompt is the system prompt used for chat sessions
+const chatSystemPrompt = `You are a helpful command-line assistant in an interactive terminal chat.
+Environment: {{os}}, {{arch}}, {{directory}}, {{shell}}
+
+Your responses are rendered as markdown in the terminal. Keep them concise.
+When you suggest a shell command, put it in a fenced code block tagged sh.
+The user can run the last command you suggested by typing /run.`
+
+// chatHelp lists the available slash commands
+const chatHelp = `Commands:
+  /run           Run the last suggested command (asks for confirmation)
+  /save [name]   Save the session (optionally under a new name)
+  /clear         Start a new session
+  /model [name]  Show or change the model
+  /help          Show this help
+  /exit          Quit (Ctrl+D also works)`
+
+// getSessionsDir returns the directory where chat sessions are stored
+func getSessionsDir() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, SessionsDirName), nil
+}
+
+// NewChatSession creates an empty session using the provider's default model
+func NewChatSession(provider Provider) *ChatSession {
+	now := time.Now()
+	return &ChatSession{
+		ID:      newRunID(now),
+		Model:   provider.DefaultModel(),
+		Created: now,
+		Updated: now,
+	}
+}
+
+// LoadChatSession reads a session by ID. An empty ID loads the most recently updated session.
+func LoadChatSession(id string) (*ChatSession, error) {
+	dir, err := getSessionsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if id == "" {
+		id, err = latestSessionID(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+		}
+		return nil, err
+	}
+
+	var session ChatSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// latestSessionID returns the ID of the most recently modified session file
+func latestSessionID(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if latest == "" || info.ModTime().After(latestTime) {
+			latest = strings.TrimSuffix(entry.Name(), ".json")
+			latestTime = info.ModTime()
+		}
+	}
+
+	if latest == "" {
+		return "", ErrSessionNotFound
+	}
+	return latest, nil
+}
+
+// Save writes the session to disk
+func (s *ChatSession) Save() error {
+	dir, err := getSessionsDir()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, DirPerms); err != nil {
+		return err
+	}
+
+	s.Updated = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, s.ID+".json"), data, ConfigFilePerms)
+}
+
+// Path returns the file path of the session
+func (s *ChatSession) Path() string {
+	dir, err := getSessionsDir()
+	if err != nil {
+		return s.ID + ".json"
+	}
+	return filepath.Join(dir, s.ID+".json")
+}
+
+// conversation converts the session history into provider messages
+func (s *ChatSession) conversation() []Message {
+	var messages []Message
+	for _, msg := range s.Messages {
+		messages = append(messages, NewTextMessage(msg.Role, msg.Content))
+	}
+	return messages
+}
+
+// chatInput reads lines with editing and history on a terminal,
+// falling back to plain line reading when stdin is not a terminal
+type chatInput struct {
+	fd     int
+	term   *term.Terminal
+	reader *bufio.Reader
+}
+
+// newChatInput creates an input reader, seeding history with previous entries (oldest first)
+func newChatInput(history []string) *chatInput {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return &chatInput{fd: fd, reader: bufio.NewReader(os.Stdin)}
+	}
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	for _, entry := range history {
+		t.History.Add(entry)
+	}
+
+	return &chatInput{fd: fd, term: t}
+}
+
+// ReadLine reads a line of input. Returns io.EOF on Ctrl+D or Ctrl+C.
+func (c *chatInput) ReadLine(prompt string) (string, error) {
+	if c.term == nil {
+		fmt.Print(prompt)
+		line, err := c.reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	state, err := term.MakeRaw(c.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(c.fd, state)
+
+	c.term.SetPrompt(prompt)
+	return c.term.ReadLine()
+}
+
+// shellBlockPattern matches fenced shell code blocks in assistant responses
+var shellBlockPattern = regexp.MustCompile("(?s)```(?:sh|bash|zsh|shell|console|powershell|ps1|cmd)?[ \t]*\r?\n(.*?)```")
+
+// lastSuggestedCommand returns the last shell code block from the assistant messages
+func lastSuggestedCommand(messages []ChatMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "assistant" {
+			continue
+		}
+		matches := shellBlockPattern.FindAllStringSubmatch(messages[i].Content, -1)
+		if len(matches) > 0 {
+			return strings.TrimSpace(matches[len(matches)-1][1])
+		}
+	}
+	return ""
+}
+
+// RunChat starts an interactive multi-turn chat session.
+// Supported flags: --resume [id] to continue a previous session, --list to show saved sessions.
+func RunChat(providers *Providers, args []string) error {
+	resume, resumeID := false, ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--resume", "-r":
+			resume = true
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				resumeID = args[i+1]
+				i++
+			}
+		case "--list", "-l":
+			return printChatSessions()
+		default:
+			return fmt.Errorf("unknown chat option: %s", args[i])
+		}
+	}
+
+	// Listing sessions works without a provider; chatting needs one
+	provider, err := providers.Get("", "")
+	if err != nil {
+		return err
+	}
+	session := NewChatSession(provider)
+	if resume {
+		if session, err = LoadChatSession(resumeID); err != nil {
+			return err
+		}
+	}
+
+	var history []string
+	for _, msg := range session.Messages {
+		if msg.Role == "user" {
+			history = append(history, msg.Content)
+		}
+	}
+	input := newChatInput(history)
+
+	if len(session.Messages) > 0 {
+		fmt.Printf(ansiDim+"Resumed session %s (%d messages)"+ansiReset+"\n", session.ID, len(session.Messages))
+		// Show the last answer for context
+		if last := session.Messages[len(session.Messages)-1]; last.Role == "assistant" {
+			renderMarkdown(last.Content)
+		}
+	}
+	fmt.Printf(ansiDim+"Chatting with %s. Type /help for commands, Ctrl+D to exit."+ansiReset+"\n", session.Model)
+
+	systemPrompt := ApplyTemplate(chatSystemPrompt)
+	var pendingContext string // Output of /run, prepended to the next message
+
+	for {
+		line, err := input.ReadLine(ansiBoldCyan + "›" + ansiReset + " ")
+		if err == io.EOF {
+			fmt.Println()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case "/exit", "/quit":
+				return nil
+
+			case "/help":
+				fmt.Println(chatHelp)
+
+			case "/clear":
+				session = NewChatSession(provider)
+				pendingContext = ""
+				fmt.Println(ansiDim + "Started a new session." + ansiReset)
+
+			case "/model":
+				if len(fields) > 1 {
+					session.Model = fields[1]
+				}
+				fmt.Printf("Model: %s\n", session.Model)
+
+			case "/save":
+				oldPath := session.Path()
+				if len(fields) > 1 {
+					session.ID = filepath.Base(fields[1])
+				}
+				if err := session.Save(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error saving session: %v\n", err)
+					continue
+				}
+				// A renamed session replaces the file saved under its old ID
+				if path := session.Path(); path != oldPath {
+					os.Remove(oldPath)
+				}
+				fmt.Printf("Saved to %s\n", session.Path())
+
+			case "/run":
+				command := lastSuggestedCommand(session.Messages)
+				if command == "" {
+					fmt.Println("No command has been suggested yet.")
+					continue
+				}
+				review := newCommandReview(providers, command, "", "", "")
+				if outcome, _ := review.Prompt(); outcome != reviewRun {
+					if err := review.cancelled(); !errors.Is(err, ErrCancelled) {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					}
+					continue
+				}
+				command = review.Command
+				output, err := RunShellCommandStreaming(command)
+				fmt.Print(ansiReset)
+				status := "succeeded"
+				if err != nil {
+					status = fmt.Sprintf("failed (%v)", err)
+				}
+				pendingContext = fmt.Sprintf("I ran `%s`, which %s. Output:\n```\n%s\n```\n\n", command, status, output)
+
+			default:
+				fmt.Printf("Unknown command: %s (type /help)\n", fields[0])
+			}
+			continue
+		}
+
+		content := pendingContext + line
+		pendingContext = ""
+		session.Messages = append(session.Messages, ChatMessage{Role: "user", Content: content})
+
+		md := newMarkdownStream()
+		ctx, stop := interruptContext()
+		response, err := complete(ctx, provider, CompletionRequest{
+			Model:     session.Model,
+			System:    systemPrompt,
+			Messages:  session.conversation(),
+			MaxTokens: ChatMaxTokens,
+		}, md.Write)
+		stop()
+		md.Flush()
+
+		if errors.Is(err, ErrInterrupted) {
+			printInterrupted()
+		} else if err != nil {
+			// Drop the failed turn so the conversation stays valid
+			session.Messages = session.Messages[:len(session.Messages)-1]
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+
+		answer := strings.TrimSpace(response.Text())
+		if answer == "" {
+			answer = "(no response)"
+		}
+		session.Messages = append(session.Messages, ChatMessage{Role: "assistant", Content: answer})
+
+		if err := session.Save(); err != nil {
+			debugLog("Failed to save session: %v", err)
+		}
+	}
+}
+
+// ListChatSessions returns saved sessions sorted by most recently updated first
+func ListChatSessions() ([]*ChatSession, error) {
+	dir, err := getSessionsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sessions []*ChatSession
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		session, err := LoadChatSession(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+
+	return sessions, nil
+}
+
+// printChatSessions prints saved sessions, most recent first
+func printChatSessions() error {
+	sessions, err := ListChatSessions()
+	if err != nil {
+		return err
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println("No saved sessions.")
+		return nil
+	}
+
+	for _, session := range sessions {
+		preview := ""
+		for _, msg := range session.Messages {
+			if msg.Role == "user" {
+				preview = strings.SplitN(msg.Content, "\n", 2)[0]
+				break
+			}
+		}
+		fmt.Printf("%-20s  %s  %3d msgs  %s\n", session.ID, session.Updated.Format(DateTimeFormat), len(session.Messages), truncateText(preview, 60))
+	}
+
+	return nil
+}
+
+// truncateText shortens text to at most max characters, ending in "..." if it was cut
+func truncateText(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-3]) + "..."
+}
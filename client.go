@@ -9,8 +9,8 @@ import (
 	"github.com/anthropics/anthropic-sdk-go/vertex"
 )
 
-// CreateClient creates an Anthropic client based on the configuration
-func CreateClient(ctx context.Context, config *Config) (anthropic.Client, error) {
+// CreateClient creates an Anthropic client based on the provider configuration
+func CreateClient(ctx context.Context, config ProviderConfig) (anthropic.Client, error) {
 	switch config.AuthType {
 	case AuthTypeAPIKey:
 		return anthropic.NewClient(option.WithAPIKey(config.APIKey)), nil
@@ -23,65 +23,32 @@ func CreateClient(ctx context.Context, config *Config) (anthropic.Client, error)
 
 // ModelForAuth returns the correct model name format for the given auth type.
 func ModelForAuth(authType AuthType) string {
-	if authType == AuthTypeVertex {
+	switch authType {
+	case AuthTypeVertex:
 		return DefaultModelVertex
+	case AuthTypeOpenAI:
+		return DefaultModelOpenAI
+	case AuthTypeOllama:
+		return DefaultModelOllama
+	default:
+		return DefaultModelAPI
 	}
-	return DefaultModelAPI
 }
 
-// GenerateResponse sends a prompt to the model and returns the response
-func GenerateResponse(client anthropic.Client, authType AuthType, systemPrompt, userQuery string) (string, error) {
-	ctx := context.Background()
-
-	stream := client.Messages.NewStreaming(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.Model(ModelForAuth(authType)),
-		MaxTokens: DefaultMaxTokens,
-		System: []anthropic.TextBlockParam{
-			{Text: systemPrompt},
-		},
-		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(userQuery)),
-		},
-		Temperature: anthropic.Float(0.05),
-	})
-
-	var response strings.Builder
-	var inputTokens, outputTokens, cacheCreationTokens, cacheReadTokens int64
-
-	for stream.Next() {
-		event := stream.Current()
-		switch event.Type {
-		case "content_block_delta":
-			if event.Delta.Type == "text_delta" {
-				response.WriteString(event.Delta.Text)
-			}
-		case "message_start":
-			// Accumulate tokens from message start
-			inputTokens += event.Message.Usage.InputTokens
-			outputTokens += event.Message.Usage.OutputTokens
-			cacheCreationTokens += event.Message.Usage.CacheCreationInputTokens
-			cacheReadTokens += event.Message.Usage.CacheReadInputTokens
-		case "message_delta":
-			// Accumulate tokens from message delta
-			inputTokens += event.Usage.InputTokens
-			outputTokens += event.Usage.OutputTokens
-			cacheCreationTokens += event.Usage.CacheCreationInputTokens
-			cacheReadTokens += event.Usage.CacheReadInputTokens
-		}
-	}
-
-	if err := stream.Err(); err != nil {
-		return "", err
-	}
-
-	// Track usage
-	if inputTokens > 0 || outputTokens > 0 {
-		usage, err := LoadUsage()
-		if err == nil {
-			usage.Add(inputTokens, outputTokens, 0, cacheCreationTokens, cacheReadTokens)
-			usage.Save()
-		}
-	}
-
-	return strings.TrimSpace(response.String()), nil
+// GenerateResponse sends a prompt to the model and returns the response.
+// If onText is non-nil, text is passed to it as it streams in.
+// Pressing Ctrl+C cancels the request; the partial response is returned with ErrInterrupted.
+func GenerateResponse(provider Provider, systemPrompt, userQuery string, onText func(string)) (string, error) {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	temperature := 0.05
+	resp, err := complete(ctx, provider, CompletionRequest{
+		System:      systemPrompt,
+		Messages:    []Message{NewTextMessage(RoleUser, userQuery)},
+		MaxTokens:   DefaultMaxTokens,
+		Temperature: &temperature,
+	}, onText)
+
+	return strings.TrimSpace(resp.Text()), err
 }
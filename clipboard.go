@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// clipboardCommands returns candidate clipboard programs for the current OS
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case OSDarwin:
+		return [][]string{{"pbcopy"}}
+	case OSWindows:
+		return [][]string{{"clip"}}
+	default:
+		return [][]string{
+			{"wl-copy"},
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+		}
+	}
+}
+
+// copyToClipboard copies text to the system clipboard.
+// Falls back to the OSC 52 terminal escape sequence (works over SSH in most terminals)
+// when no clipboard program is installed.
+func copyToClipboard(text string) error {
+	for _, candidate := range clipboardCommands() {
+		if _, err := exec.LookPath(candidate[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(candidate[0], candidate[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err == nil {
+			return nil
+		}
+	}
+
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Printf("\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+		return nil
+	}
+
+	return ErrNoClipboard
+}
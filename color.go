@@ -0,0 +1,30 @@
+package main
+
+// ANSI escape codes for x's own output. They're cleared when NO_COLOR is set.
+var (
+	ansiReset       = "\033[0m"
+	ansiBold        = "\033[1m"
+	ansiDim         = "\033[2m"
+	ansiRed         = "\033[31m"
+	ansiGreen       = "\033[32m"
+	ansiYellow      = "\033[33m"
+	ansiOrange      = "\033[38;5;208m"
+	ansiBoldGreen   = "\033[1;32m"
+	ansiBoldBlue    = "\033[1;34m"
+	ansiBoldMagenta = "\033[1;35m"
+	ansiBoldCyan    = "\033[1;36m"
+)
+
+// noColor is set when colors are off (NO_COLOR)
+var noColor bool
+
+// disableColors turns off colors in everything x prints
+func disableColors() {
+	noColor = true
+	for _, code := range []*string{
+		&ansiReset, &ansiBold, &ansiDim, &ansiRed, &ansiGreen, &ansiYellow, &ansiOrange,
+		&ansiBoldGreen, &ansiBoldBlue, &ansiBoldMagenta, &ansiBoldCyan,
+	} {
+		*code = ""
+	}
+}
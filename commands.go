@@ -11,49 +11,101 @@ import (
 	"github.com/charmbracelet/glamour/styles"
 )
 
-// RunConfigure handles the configure command
-func RunConfigure() error {
+// RunConfigure handles the configure command.
+// With a name argument (x configure <name>), configures an additional named
+// provider that steps can select with provider: <name>.
+func RunConfigure(args []string) error {
 	reader := bufio.NewReader(os.Stdin)
 
-	fmt.Println("Choose authentication type:")
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	fmt.Println("Choose LLM provider:")
 	fmt.Println("1. Anthropic API Key")
 	fmt.Println("2. Google Cloud Vertex AI")
-	fmt.Print("Enter choice (1 or 2): ")
+	fmt.Println("3. OpenAI-compatible API (OpenAI, vLLM, LM Studio, llama.cpp server)")
+	fmt.Println("4. Ollama")
+	fmt.Print("Enter choice (1-4): ")
 
 	choice, _ := reader.ReadString('\n')
 	choice = strings.TrimSpace(choice)
 
-	config := &Config{}
+	var pc ProviderConfig
 
 	switch choice {
 	case "1":
-		config.AuthType = AuthTypeAPIKey
+		pc.AuthType = AuthTypeAPIKey
 		fmt.Print("Enter your Anthropic API key: ")
 		apiKey, _ := reader.ReadString('\n')
-		config.APIKey = strings.TrimSpace(apiKey)
+		pc.APIKey = strings.TrimSpace(apiKey)
 
 	case "2":
-		config.AuthType = AuthTypeVertex
+		pc.AuthType = AuthTypeVertex
 		fmt.Print("Enter your Google Cloud Project ID: ")
 		projectID, _ := reader.ReadString('\n')
-		config.ProjectID = strings.TrimSpace(projectID)
+		pc.ProjectID = strings.TrimSpace(projectID)
 
 		fmt.Print("Enter your Vertex AI region (e.g., us-east5): ")
 		region, _ := reader.ReadString('\n')
-		config.Region = strings.TrimSpace(region)
+		pc.Region = strings.TrimSpace(region)
+
+	case "3":
+		pc.AuthType = AuthTypeOpenAI
+		pc.BaseURL = promptWithDefault(reader, "Enter the API base URL", DefaultOpenAIBaseURL)
+		fmt.Print("Enter your API key (leave empty for local servers): ")
+		apiKey, _ := reader.ReadString('\n')
+		pc.APIKey = strings.TrimSpace(apiKey)
+		pc.Model = promptWithDefault(reader, "Enter the model name", DefaultModelOpenAI)
+
+	case "4":
+		pc.AuthType = AuthTypeOllama
+		pc.BaseURL = promptWithDefault(reader, "Enter the Ollama URL", DefaultOllamaBaseURL)
+		pc.Model = promptWithDefault(reader, "Enter the model name", DefaultModelOllama)
 
 	default:
 		return fmt.Errorf("%w: %s", ErrInvalidChoice, choice)
 	}
 
+	// Keep the rest of the existing configuration
+	config, err := LoadConfig()
+	if err != nil {
+		config = &Config{}
+	}
+
+	if name == "" {
+		config.ProviderConfig = pc
+	} else {
+		if config.Providers == nil {
+			config.Providers = make(map[string]ProviderConfig)
+		}
+		config.Providers[name] = pc
+	}
+
 	if err := config.Save(); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
+	if name != "" {
+		fmt.Printf("Provider %q saved. Use it in a step with provider: %s\n", name, name)
+		return nil
+	}
 	fmt.Println("Configuration saved successfully!")
 	return nil
 }
 
+// promptWithDefault asks for a value, returning def if the answer is empty
+func promptWithDefault(reader *bufio.Reader, label, def string) string {
+	fmt.Printf("%s [%s]: ", label, def)
+	value, _ := reader.ReadString('\n')
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return def
+	}
+	return value
+}
+
 // RunCommandsEditor opens the commands configuration file in an editor
 func RunCommandsEditor() error {
 	path, err := EnsureCommandsFile()
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CommandTest is a declarative test for a command, defined under a top-level
+// tests: key in a commands file or in its .test.yaml companion file
+type CommandTest struct {
+	Name    string              `yaml:"name"`
+	Command string              `yaml:"command"`            // Command to run
+	Args    []string            `yaml:"args"`               // Arguments passed to the command
+	Stdin   string              `yaml:"stdin"`              // Input for confirm prompts (e.g. "n\n"); empty accepts the default
+	LLM     []*scriptedResponse `yaml:"llm"`                // Scripted LLM responses (same format as X_FAKE_LLM)
+	Replay  string              `yaml:"replay"`             // Fixture directory to replay LLM responses from
+	BySeq   bool                `yaml:"replay_by_sequence"` // Replay by call number when a prompt changed
+	Exec    bool                `yaml:"allow_exec"`         // Run shell commands that aren't mocked
+	Mock    TestMocks           `yaml:"mock"`
+	Expect  TestExpect          `yaml:"expect"`
+	File    string              `yaml:"-"` // Where this test was loaded from
+}
+
+// TestMocks replaces step outputs and command results during a test
+type TestMocks struct {
+	Steps map[string]string `yaml:"steps"` // Step id (or command.step) -> output; the step isn't run
+	Exec  []ExecMock        `yaml:"exec"`  // Results for matching shell commands; they aren't run
+}
+
+// ExecMock is a canned result for shell commands matching a pattern
+type ExecMock struct {
+	Command  string `yaml:"command"` // Regexp matched against the command
+	Output   string `yaml:"output"`
+	ExitCode int    `yaml:"exit_code"`
+}
+
+// TestExpect holds a test's assertions
+type TestExpect struct {
+	Output   *string      `yaml:"output"`   // Final output equals (ignoring surrounding whitespace)
+	Contains stringList   `yaml:"contains"` // Final output contains each string
+	Matches  string       `yaml:"matches"`  // Final output matches the regexp
+	Error    string       `yaml:"error"`    // Command fails with an error containing this text
+	Ran      stringList   `yaml:"ran"`      // Steps that must run
+	Skipped  stringList   `yaml:"skipped"`  // Steps that must not run
+	Executed []ExecExpect `yaml:"executed"` // Shell commands that must be executed (or proposed)
+}
+
+// ExecExpect asserts that a matching shell command was executed
+type ExecExpect struct {
+	Command string `yaml:"command"` // Regexp matched against the command
+	Confirm *bool  `yaml:"confirm"` // Whether the user was asked to confirm it
+}
+
+// stringList is a list of strings that can also be written as a single string
+type stringList []string
+
+// UnmarshalYAML accepts a string or a list of strings
+func (l *stringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = stringList{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// execRecord is a shell command seen during a test
+type execRecord struct {
+	Command string
+	Confirm bool
+}
+
+// testRun intercepts pipeline execution while a command test runs.
+// Its methods are safe to call on nil, which is the normal (non-test) case.
+type testRun struct {
+	test     *CommandTest
+	execMock []*regexp.Regexp
+	steps    []string
+	execs    []execRecord
+}
+
+// activeTest is the command test currently running, if any
+var activeTest *testRun
+
+// startStep records that a step started
+func (t *testRun) startStep(step string) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, step)
+}
+
+// mockedStep returns the mocked output for a step
+func (t *testRun) mockedStep(step string) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+
+	// Prefer the most specific pattern
+	patterns := make([]string, 0, len(t.test.Mock.Steps))
+	for pattern := range t.test.Mock.Steps {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+
+	for _, pattern := range patterns {
+		if stepMatches(pattern, step) {
+			return t.test.Mock.Steps[pattern], true
+		}
+	}
+	return "", false
+}
+
+// recordExec records a shell command about to be executed
+func (t *testRun) recordExec(command string, confirm bool) {
+	if t == nil {
+		return
+	}
+	t.execs = append(t.execs, execRecord{Command: command, Confirm: confirm})
+}
+
+// mockedExec returns the mocked result for a shell command. A command that
+// isn't mocked fails without running unless the test allows exec.
+func (t *testRun) mockedExec(command string) (string, bool, error) {
+	if t == nil {
+		return "", false, nil
+	}
+
+	for i, re := range t.execMock {
+		if !re.MatchString(command) {
+			continue
+		}
+		mock := t.test.Mock.Exec[i]
+		if mock.ExitCode != 0 {
+			return mock.Output, true, &ExitStatusError{Code: mock.ExitCode}
+		}
+		return mock.Output, true, nil
+	}
+	if !t.test.Exec {
+		return "", true, fmt.Errorf("%w: %s", ErrUnmockedExec, command)
+	}
+	return "", false, nil
+}
+
+// ranStep reports whether a step matching the pattern started
+func (t *testRun) ranStep(pattern string) bool {
+	for _, step := range t.steps {
+		if stepMatches(pattern, step) {
+			return true
+		}
+	}
+	return false
+}
+
+// check compares the result of a test run with its expectations
+func (t *testRun) check(output string, runErr error) []string {
+	expect := t.test.Expect
+	var failures []string
+
+	if runErr != nil && expect.Error == "" {
+		failures = append(failures, fmt.Sprintf("unexpected error: %v", runErr))
+	}
+	if expect.Error != "" {
+		if runErr == nil {
+			failures = append(failures, fmt.Sprintf("expected error containing %q, got none", expect.Error))
+		} else if !strings.Contains(runErr.Error(), expect.Error) {
+			failures = append(failures, fmt.Sprintf("expected error containing %q, got %q", expect.Error, runErr.Error()))
+		}
+	}
+
+	output = strings.TrimSpace(output)
+	if expect.Output != nil && output != strings.TrimSpace(*expect.Output) {
+		failures = append(failures, fmt.Sprintf("expected output %q, got %q", strings.TrimSpace(*expect.Output), output))
+	}
+	for _, s := range expect.Contains {
+		if !strings.Contains(output, s) {
+			failures = append(failures, fmt.Sprintf("expected output to contain %q, got %q", s, output))
+		}
+	}
+	if expect.Matches != "" {
+		re, err := regexp.Compile(expect.Matches)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid matches pattern: %v", err))
+		} else if !re.MatchString(output) {
+			failures = append(failures, fmt.Sprintf("expected output to match %q, got %q", expect.Matches, output))
+		}
+	}
+
+	for _, step := range expect.Ran {
+		if !t.ranStep(step) {
+			failures = append(failures, fmt.Sprintf("expected step %s to run", step))
+		}
+	}
+	for _, step := range expect.Skipped {
+		if t.ranStep(step) {
+			failures = append(failures, fmt.Sprintf("expected step %s to be skipped", step))
+		}
+	}
+
+	for _, want := range expect.Executed {
+		if !t.executed(want) {
+			desc := fmt.Sprintf("expected a command matching %q to be executed", want.Command)
+			if want.Confirm != nil {
+				desc += fmt.Sprintf(" (confirm: %v)", *want.Confirm)
+			}
+			failures = append(failures, desc)
+		}
+	}
+
+	return failures
+}
+
+// executed reports whether a recorded command matches the expectation
+func (t *testRun) executed(want ExecExpect) bool {
+	re, err := regexp.Compile(want.Command)
+	if err != nil {
+		return false
+	}
+	for _, exec := range t.execs {
+		if re.MatchString(exec.Command) && (want.Confirm == nil || *want.Confirm == exec.Confirm) {
+			return true
+		}
+	}
+	return false
+}
+
+// testsFilePath returns the companion test file of a commands file
+// (xcommands.yaml -> xcommands.test.yaml)
+func testsFilePath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + TestsFileSuffix
+}
+
+// LoadCommandTests collects tests from the global and local commands files
+// and their .test.yaml companion files
+func LoadCommandTests() ([]*CommandTest, error) {
+	globalPath, err := getCommandsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var tests []*CommandTest
+	for _, path := range append([]string{globalPath}, findAllLocalCommandsFiles()...) {
+		for _, file := range []string{path, testsFilePath(path)} {
+			fileTests, err := loadTestsFile(file)
+			if err != nil {
+				return nil, err
+			}
+			tests = append(tests, fileTests...)
+		}
+	}
+
+	return tests, nil
+}
+
+// loadTestsFile reads the tests: section of a file, if it exists
+func loadTestsFile(path string) ([]*CommandTest, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Tests []*CommandTest `yaml:"tests"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tests in %s: %w", path, err)
+	}
+
+	for i, test := range file.Tests {
+		test.File = path
+		if test.Command == "" {
+			return nil, fmt.Errorf("test %d in %s has no command", i+1, path)
+		}
+		if test.Name == "" {
+			test.Name = fmt.Sprintf("test %d", i+1)
+		}
+		if test.Replay != "" && !filepath.IsAbs(test.Replay) {
+			test.Replay = filepath.Join(filepath.Dir(path), test.Replay)
+		}
+	}
+
+	return file.Tests, nil
+}
+
+// RunCommandTests runs command tests and prints a pass/fail report.
+// Args may name a command or test to run and -v to show each test's output.
+func RunCommandTests(args []string) error {
+	var filter string
+	verbose := false
+	for _, arg := range args {
+		switch arg {
+		case "-v", "--verbose":
+			verbose = true
+		default:
+			filter = arg
+		}
+	}
+
+	config, err := LoadCommandsConfig()
+	if err != nil {
+		return err
+	}
+
+	tests, err := LoadCommandTests()
+	if err != nil {
+		return err
+	}
+
+	var selected []*CommandTest
+	for _, test := range tests {
+		if filter == "" || test.Command == filter || test.Name == filter {
+			selected = append(selected, test)
+		}
+	}
+	if len(selected) == 0 {
+		if filter != "" {
+			return fmt.Errorf("%w for %s", ErrNoTests, filter)
+		}
+		return ErrNoTests
+	}
+
+	llmConfig, llmErr := LoadConfig()
+
+	passed, failed := 0, 0
+	for _, test := range selected {
+		start := time.Now()
+		failures, log := runCommandTest(config, NewProviders(llmConfig, llmErr), test)
+		elapsed := time.Since(start).Round(time.Millisecond)
+
+		if len(failures) == 0 {
+			passed++
+			fmt.Printf(ansiGreen+"✓"+ansiReset+" %s: %s "+ansiDim+"(%s)"+ansiReset+"\n", test.Command, test.Name, elapsed)
+		} else {
+			failed++
+			fmt.Printf(ansiRed+"✗"+ansiReset+" %s: %s "+ansiDim+"(%s)"+ansiReset+"\n", test.Command, test.Name, elapsed)
+			for _, failure := range failures {
+				fmt.Printf("    %s\n", failure)
+			}
+		}
+
+		if (verbose || len(failures) > 0) && strings.TrimSpace(log) != "" {
+			fmt.Print("    " + ansiDim + "--- output ---" + ansiReset + "\n")
+			for _, line := range strings.Split(strings.TrimRight(log, "\n"), "\n") {
+				fmt.Printf("    "+ansiDim+"%s"+ansiReset+"\n", line)
+			}
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrTestsFailed, failed, len(selected))
+	}
+	return nil
+}
+
+// runCommandTest runs one test with its mocks and stdin, capturing everything
+// the command prints. It returns the failed assertions and the captured output.
+func runCommandTest(config *CommandsConfig, providers *Providers, test *CommandTest) ([]string, string) {
+	cmd, ok := config.Commands[test.Command]
+	if !ok {
+		return []string{fmt.Sprintf("unknown command: %s", test.Command)}, ""
+	}
+
+	run := &testRun{test: test}
+	for _, mock := range test.Mock.Exec {
+		re, err := regexp.Compile(mock.Command)
+		if err != nil {
+			return []string{fmt.Sprintf("invalid exec mock pattern %q: %v", mock.Command, err)}, ""
+		}
+		run.execMock = append(run.execMock, re)
+	}
+
+	if len(test.LLM) > 0 {
+		script := &scriptedScript{Responses: test.LLM}
+		if err := script.compile(); err != nil {
+			return []string{err.Error()}, ""
+		}
+		providers.script = script
+	}
+	if test.Replay != "" {
+		providers.replay = newFixtureStore(test.Replay)
+		providers.replay.bySeq = test.BySeq
+	}
+
+	stdin, err := os.CreateTemp("", "x-test-stdin-*")
+	if err != nil {
+		return []string{err.Error()}, ""
+	}
+	defer os.Remove(stdin.Name())
+	defer stdin.Close()
+	stdin.WriteString(test.Stdin)
+	stdin.Seek(0, 0)
+
+	out, err := os.CreateTemp("", "x-test-output-*")
+	if err != nil {
+		return []string{err.Error()}, ""
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	origStdin, origStdout, origStderr := os.Stdin, os.Stdout, os.Stderr
+	defer func() {
+		activeTest = nil
+		os.Stdin, os.Stdout, os.Stderr = origStdin, origStdout, origStderr
+	}()
+	os.Stdin, os.Stdout, os.Stderr = stdin, out, out
+	activeTest = run
+
+	output, runErr := RunPipeline(providers, config, cmd, test.Args, RunOptions{}, true)
+
+	log, _ := os.ReadFile(out.Name())
+	return run.check(output, runErr), string(log)
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Shell completion scripts. Each asks x __complete for candidates, one
+// "value<TAB>description" (or just "value") per line. A first line of :files
+// or :dirs asks the shell to complete paths instead.
+const (
+	bashCompletion = `# x completion for bash
+_x_complete() {
+  local cur=${COMP_WORDS[COMP_CWORD]}
+  local IFS=$'\n'
+  local out=($(x __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null))
+  case "${out[0]}" in
+    :files) compopt -o filenames; COMPREPLY=($(compgen -f -- "$cur")); return ;;
+    :dirs) compopt -o filenames; COMPREPLY=($(compgen -d -- "$cur")); return ;;
+  esac
+  COMPREPLY=("${out[@]%%$'\t'*}")
+}
+complete -F _x_complete x
+`
+
+	zshCompletion = `#compdef x
+# x completion for zsh
+_x() {
+  local -a out candidates
+  local line value desc
+  out=("${(@f)$(x __complete "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null)}")
+  case "$out[1]" in
+    :files) _files; return ;;
+    :dirs) _files -/; return ;;
+  esac
+  for line in $out; do
+    value=${line%%$'\t'*}
+    desc=""
+    [[ $line == *$'\t'* ]] && desc=${line#*$'\t'}
+    candidates+=("${value//:/\\:}:$desc")
+  done
+  _describe x candidates
+}
+compdef _x x
+`
+
+	fishCompletion = `# x completion for fish
+function __x_complete
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    set -l current (commandline -ct)
+    set -l out (x __complete $tokens $current 2>/dev/null)
+    switch "$out[1]"
+        case :files
+            __fish_complete_path $current
+        case :dirs
+            __fish_complete_directories $current
+        case '*'
+            printf '%s\n' $out
+    end
+end
+complete -c x -f -a '(__x_complete)'
+`
+
+	powershellCompletion = `# x completion for PowerShell
+Register-ArgumentCompleter -Native -CommandName x -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -ne '' -and $words.Count -gt 0) {
+        $words = @($words | Select-Object -First ($words.Count - 1))
+    }
+    $out = @(& x __complete @words $wordToComplete 2>$null)
+    if ($out.Count -gt 0 -and ($out[0] -eq ':files' -or $out[0] -eq ':dirs')) {
+        return
+    }
+    foreach ($line in $out) {
+        $value, $desc = $line -split "` + "`" + `t", 2
+        if (-not $desc) { $desc = $value }
+        [System.Management.Automation.CompletionResult]::new($value, $value, 'ParameterValue', $desc)
+    }
+}
+`
+)
+
+// Arg completion kinds (the complete field of an arg)
+const (
+	CompleteFiles   = "files"
+	CompleteDirs    = "dirs"
+	CompleteChoices = "choices"
+	CompleteCommand = "command:" // Followed by the x command that prints the candidates
+)
+
+// builtinCompletions are the built-in commands offered for the first word
+var builtinCompletions = []completion{
+	{CmdConfigure, "Configure the LLM provider"},
+	{CmdChat, "Start an interactive chat"},
+	{CmdCommands, "Edit custom commands"},
+	{CmdExplain, "Explain a shell command"},
+	{CmdHistory, "Search generated shell commands"},
+	{CmdRuns, "List past runs"},
+	{CmdMCP, "Serve commands as MCP tools"},
+	{CmdServe, "Serve an HTTP API for running commands"},
+	{CmdShellInit, "Print a shell widget for generated commands"},
+	{CmdCompletion, "Print a shell completion script"},
+	{CmdUsage, "Show token usage and cost"},
+	{CmdUpgrade, "Upgrade to latest version"},
+	{CmdVersion, "Show current version"},
+}
+
+// globalFlagCompletions are the global flags, offered before the command
+var globalFlagCompletions = []completion{
+	{FlagDryRun, "Show what would run without running it"},
+	{FlagDebug, "Print prompts and step details"},
+	{FlagModel, "Model for every LLM call"},
+	{FlagQuiet, "Don't show commands as they run"},
+	{FlagJSON, "Print the result as JSON"},
+	{FlagOutput, "Output format: text, json or jsonl"},
+	{FlagYes, "Run commands without asking"},
+	{FlagNoInput, "Never ask; fail if confirmation is needed"},
+}
+
+// builtinArgCompletions are the words offered after a built-in command
+var builtinArgCompletions = map[string][]completion{
+	CmdCommands:   {{"test", "Run command tests"}},
+	CmdChat:       {{"--resume", "Continue the last session"}},
+	CmdRuns:       {{"show", "Inspect a run"}, {"rerun", "Run a command again"}, {"resume", "Continue an agent"}},
+	CmdMCP:        {{"serve", "Serve commands over stdio"}},
+	CmdExplain:    {{"--run", "Offer to run the command afterwards"}},
+	CmdShellInit:  {{"bash", ""}, {"zsh", ""}, {"fish", ""}},
+	CmdCompletion: {{"bash", ""}, {"zsh", ""}, {"fish", ""}, {"powershell", ""}},
+}
+
+// completion is a completion candidate
+type completion struct {
+	Value       string
+	Description string
+}
+
+// completionCache holds what completion needs from the commands config,
+// with the files it was loaded from so it can tell when it's stale
+type completionCache struct {
+	Version  string              `json:"version"`
+	Files    []completionFile    `json:"files"`
+	Commands []completionCommand `json:"commands"`
+	Groups   map[string]string   `json:"groups,omitempty"` // Group descriptions
+
+	// Output of command: hints, by command name
+	Candidates map[string]commandCandidates `json:"candidates,omitempty"`
+}
+
+// commandCandidates are the lines printed by a command: hint's command
+type commandCandidates struct {
+	Directory string    `json:"directory"` // Where it ran; the output may depend on it
+	Time      time.Time `json:"time"`
+	Values    []string  `json:"values"`
+}
+
+// completionFile identifies a version of a config file
+type completionFile struct {
+	Path    string `json:"path"`
+	ModTime int64  `json:"mod_time"`
+	Size    int64  `json:"size"`
+}
+
+// completionCommand is a command as completion sees it
+type completionCommand struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Args        []Arg  `json:"args"`
+}
+
+// RunCompletion handles: x completion bash|zsh|fish|powershell
+func RunCompletion(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: x %s bash|zsh|fish|powershell", CmdCompletion)
+	}
+
+	scripts := map[string]string{
+		"bash":       bashCompletion,
+		"zsh":        zshCompletion,
+		"fish":       fishCompletion,
+		"powershell": powershellCompletion,
+	}
+	script, ok := scripts[args[0]]
+	if !ok {
+		return fmt.Errorf("unsupported shell: %s (use bash, zsh, fish or powershell)", args[0])
+	}
+	os.Stdout.WriteString(script)
+	return nil
+}
+
+// RunComplete handles x __complete <words...> <current>, called by the
+// completion scripts. It prints the candidates for the current word.
+func RunComplete(args []string) {
+	current := ""
+	if len(args) > 0 {
+		current = args[len(args)-1]
+		args = args[:len(args)-1]
+	}
+
+	for _, c := range completeWords(args, current) {
+		if c.Description == "" {
+			fmt.Println(c.Value)
+		} else {
+			fmt.Printf("%s\t%s\n", c.Value, c.Description)
+		}
+	}
+}
+
+// completeWords returns the candidates for the current word, given the words before it
+func completeWords(words []string, current string) []completion {
+	// Skip the global flags before the command
+	for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+		if words[0] == FlagModel || words[0] == FlagOutput {
+			if len(words) == 1 {
+				if words[0] == FlagOutput {
+					return filterCompletions([]completion{{OutputText, ""}, {OutputJSON, ""}, {OutputJSONL, ""}}, current)
+				}
+				return nil // The model name
+			}
+			words = words[1:]
+		}
+		words = words[1:]
+	}
+
+	if len(words) == 0 && strings.HasPrefix(current, "-") {
+		return filterCompletions(globalFlagCompletions, current)
+	}
+	if len(words) == 0 {
+		return filterCompletions(append(slices.Clone(builtinCompletions), groupCompletions(loadCompletionConfig(), "")...), current)
+	}
+
+	name := words[0]
+	if builtin, ok := builtinArgCompletions[name]; ok {
+		if len(words) == 1 {
+			return filterCompletions(builtin, current)
+		}
+		return nil
+	}
+
+	// Follow groups to the command: x db migrate <args>
+	config := loadCompletionConfig()
+	name, args := config.FindCommand(words)
+	if len(args) == 0 && config.IsGroup(name) {
+		return filterCompletions(groupCompletions(config, name), current)
+	}
+	if cmd, ok := config.Commands[name]; ok {
+		return completeArg(cmd, len(args), current)
+	}
+	return nil
+}
+
+// groupCompletions returns the commands and subgroups in a group, by their
+// last name segment. The empty group is the top level.
+func groupCompletions(config *CommandsConfig, group string) []completion {
+	commands, groups := config.groupEntries(group)
+	var candidates []completion
+	for _, name := range commands {
+		candidates = append(candidates, completion{name[strings.LastIndex(name, GroupSeparator)+1:], config.Commands[name].Description})
+	}
+	for _, name := range groups {
+		candidates = append(candidates, completion{name[strings.LastIndex(name, GroupSeparator)+1:], config.Groups[name]})
+	}
+	return candidates
+}
+
+// completeArg returns the candidates for a command's argument at index
+func completeArg(cmd Command, index int, current string) []completion {
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+	if index >= len(cmd.Args) {
+		// Later words belong to a rest argument
+		if !cmd.Args[len(cmd.Args)-1].Rest {
+			return nil
+		}
+		index = len(cmd.Args) - 1
+	}
+	arg := cmd.Args[index]
+
+	kind := arg.Complete
+	if kind == "" && len(arg.Choices) > 0 {
+		kind = CompleteChoices
+	}
+
+	switch {
+	case kind == CompleteFiles:
+		return []completion{{Value: ":files"}}
+	case kind == CompleteDirs:
+		return []completion{{Value: ":dirs"}}
+	case kind == CompleteChoices:
+		var candidates []completion
+		for _, choice := range arg.Choices {
+			candidates = append(candidates, completion{choice, arg.Description})
+		}
+		return filterCompletions(candidates, current)
+	case strings.HasPrefix(kind, CompleteCommand):
+		return filterCompletions(commandCompletions(strings.TrimPrefix(kind, CompleteCommand)), current)
+	}
+	return nil
+}
+
+// commandCompletions runs an x command and returns each line it outputs as
+// a candidate. Nothing it prints reaches the shell, and it can't prompt.
+// The lines are cached for a short while, so pressing Tab again is fast.
+func commandCompletions(name string) []completion {
+	name = strings.TrimSpace(name)
+	directory, _ := os.Getwd()
+
+	cachePath, cache := readCompletionCache()
+	values, ok := cache.Candidates[name]
+	if !ok || values.Directory != directory || time.Since(values.Time) > CompletionCandidatesTTL {
+		output, err := runCompletionCommand(name)
+		if err != nil {
+			debugLog("Completion: %v", err)
+			return nil
+		}
+
+		values = commandCandidates{Directory: directory, Time: time.Now()}
+		for _, line := range strings.Split(output, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				values.Values = append(values.Values, line)
+			}
+		}
+		if cache.Candidates == nil {
+			cache.Candidates = make(map[string]commandCandidates)
+		}
+		cache.Candidates[name] = values
+		writeCompletionCache(cachePath, cache)
+	}
+
+	candidates := make([]completion, 0, len(values.Values))
+	for _, value := range values.Values {
+		candidates = append(candidates, completion{Value: value})
+	}
+	return candidates
+}
+
+// runCompletionCommand runs the command of a command: hint and returns its
+// output. Commands with llm or agentic steps are refused, since they're slow
+// and cost money on every Tab press.
+func runCompletionCommand(name string) (string, error) {
+	config, err := LoadCommandsConfig()
+	if err != nil {
+		return "", err
+	}
+	cmd, ok := config.Commands[name]
+	if !ok {
+		return "", fmt.Errorf("unknown command: %s", name)
+	}
+	if usesModel(config, cmd, nil) {
+		return "", fmt.Errorf("not running %s: completion commands can't have llm or agentic steps", name)
+	}
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer devNull.Close()
+	// Nothing may reach the terminal in the middle of a Tab completion
+	in, out, errOut := os.Stdin, os.Stdout, os.Stderr
+	wasUnattended, wasSkipRunLog := unattended, skipRunLog
+	defer func() {
+		os.Stdin, os.Stdout, os.Stderr = in, out, errOut
+		unattended, skipRunLog = wasUnattended, wasSkipRunLog
+	}()
+	os.Stdin, os.Stdout, os.Stderr = devNull, devNull, devNull
+	unattended = true
+	skipRunLog = true
+
+	return RunPipeline(loadProviders(RunOptions{}), config, cmd, nil, RunOptions{}, true)
+}
+
+// usesModel reports whether a command has llm or agentic steps, including
+// in the commands it calls as subcommands
+func usesModel(config *CommandsConfig, cmd Command, seen map[string]bool) bool {
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+	if seen[cmd.Name] {
+		return false
+	}
+	seen[cmd.Name] = true
+
+	for _, step := range cmd.Steps {
+		if step.LLM != nil || step.Agentic != nil {
+			return true
+		}
+		if step.Subcommand != nil {
+			if sub, ok := config.Commands[step.Subcommand.Name]; ok && usesModel(config, sub, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterCompletions returns the candidates starting with prefix, sorted
+func filterCompletions(candidates []completion, prefix string) []completion {
+	var result []completion
+	for _, c := range candidates {
+		if strings.HasPrefix(c.Value, prefix) {
+			result = append(result, c)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+// loadCompletionConfig returns the commands to complete. They're cached
+// until a config file changes, so most completions don't parse any YAML.
+func loadCompletionConfig() *CommandsConfig {
+	var files []completionFile
+	paths := findAllLocalCommandsFiles()
+	if global, err := getCommandsPath(); err == nil {
+		paths = append([]string{global}, paths...)
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			files = append(files, completionFile{path, info.ModTime().UnixNano(), info.Size()})
+		}
+	}
+
+	cachePath, cache := readCompletionCache()
+	if cache.Version == Version && slices.Equal(cache.Files, files) {
+		return cache.config()
+	}
+
+	config, err := LoadCommandsConfig()
+	if err != nil {
+		return &CommandsConfig{}
+	}
+	cache = completionCache{Version: Version, Files: files, Groups: config.Groups}
+	for name, cmd := range config.Commands {
+		cache.Commands = append(cache.Commands, completionCommand{name, cmd.Description, cmd.Args})
+	}
+
+	writeCompletionCache(cachePath, cache)
+	return cache.config()
+}
+
+// readCompletionCache returns the completion cache file path and its
+// contents, which are empty if it can't be read
+func readCompletionCache() (string, completionCache) {
+	var cache completionCache
+	path, err := getCompletionCachePath()
+	if err != nil {
+		return "", cache
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &cache) != nil {
+			cache = completionCache{}
+		}
+	}
+	return path, cache
+}
+
+// writeCompletionCache saves the completion cache. Failing to save it only
+// makes the next completion slower.
+func writeCompletionCache(path string, cache completionCache) {
+	if path == "" {
+		return
+	}
+	if data, err := json.Marshal(cache); err == nil {
+		if err := os.MkdirAll(filepath.Dir(path), DirPerms); err == nil {
+			os.WriteFile(path, data, ConfigFilePerms)
+		}
+	}
+}
+
+// config returns the cached commands as a commands config
+func (c completionCache) config() *CommandsConfig {
+	config := &CommandsConfig{Commands: make(map[string]Command, len(c.Commands)), Groups: c.Groups}
+	for _, cmd := range c.Commands {
+		config.Commands[cmd.Name] = Command{Name: cmd.Name, Description: cmd.Description, Args: cmd.Args}
+	}
+	return config
+}
+
+// getCompletionCachePath returns the completion cache file path
+func getCompletionCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, AppConfigDir, CompletionCacheFile), nil
+}
@@ -2,16 +2,28 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
-// Config holds the application configuration
-type Config struct {
+// ProviderConfig holds the settings for one LLM provider
+type ProviderConfig struct {
 	AuthType  AuthType `json:"auth_type"`
 	APIKey    string   `json:"api_key,omitempty"`
 	ProjectID string   `json:"project_id,omitempty"`
 	Region    string   `json:"region,omitempty"`
+	BaseURL   string   `json:"base_url,omitempty"` // For openai and ollama
+	Model     string   `json:"model,omitempty"`    // Overrides the default model
+}
+
+// Config holds the application configuration.
+// The embedded ProviderConfig is the default provider; additional named
+// providers can be selected per step with the provider field.
+type Config struct {
+	ProviderConfig
+	Providers     map[string]ProviderConfig `json:"providers,omitempty"`
+	ConfirmPolicy string                    `json:"confirm_policy,omitempty"` // See the Confirm* constants
 }
 
 // getConfigDir returns the application config directory path
@@ -73,6 +85,19 @@ func (c *Config) Save() error {
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
+	if err := c.ProviderConfig.Validate(); err != nil {
+		return err
+	}
+	for name, pc := range c.Providers {
+		if err := pc.Validate(); err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks if the provider configuration is valid
+func (c *ProviderConfig) Validate() error {
 	switch c.AuthType {
 	case AuthTypeAPIKey:
 		if c.APIKey == "" {
@@ -85,6 +110,8 @@ func (c *Config) Validate() error {
 		if c.Region == "" {
 			return ErrMissingRegion
 		}
+	case AuthTypeOpenAI, AuthTypeOllama:
+		// Base URL and model have defaults; API key is optional for local servers
 	default:
 		return ErrInvalidAuthType
 	}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// explainSystemPrompt is used when the user asks for an explanation at a confirm prompt
+const explainSystemPrompt = `You explain shell commands to a user who is deciding whether to run them.
+Environment: {{os}}, {{arch}}, {{directory}}, {{shell}}
+
+Explain what the command does, part by part: each program, flag, pipe and redirection.
+Point out side effects, anything destructive or irreversible, and what the user should check first.
+Use concise markdown. Do not suggest running anything else unless it is clearly safer.`
+
+// reviewOutcome is the final decision made at a command review prompt
+type reviewOutcome int
+
+const (
+	reviewRun    reviewOutcome = iota // Run the (possibly edited) command
+	reviewCancel                      // Don't run the command
+	reviewRefine                      // User gave feedback to regenerate the command
+)
+
+// commandReview holds a command being reviewed at a confirmation prompt.
+// Besides yes/no, the user can edit the command, refine it with feedback,
+// copy it to the clipboard or ask for an explanation.
+type commandReview struct {
+	Command   string
+	Summary   string
+	Risk      string
+	Safer     string
+	Rules     []riskMatch // Risk rules the command triggers
+	CanRefine bool        // Offer the refine option
+	Err       error       // Why the command was cancelled without asking, if it couldn't ask
+	Refused   bool        // Declined without asking: by the confirm policy, or nobody could answer
+
+	providers *Providers
+}
+
+// newCommandReview creates a review for a command. The default provider is used for explanations.
+// The risk is raised if the command triggers a risk rule rated higher.
+func newCommandReview(providers *Providers, command, summary, risk, safer string) *commandReview {
+	rules := classifyCommand(command)
+	return &commandReview{
+		Command:   command,
+		Summary:   summary,
+		Risk:      combineRisk(risk, rules),
+		Safer:     safer,
+		Rules:     rules,
+		providers: providers,
+	}
+}
+
+// Prompt shows the command and asks the user what to do with it.
+// Edit, copy and explain are handled here; the returned outcome is run, cancel or refine.
+// For refine, the user's feedback is returned as the second value.
+func (r *commandReview) Prompt() (reviewOutcome, string) {
+	activeEvents.confirmRequired(r.Command, r.Summary, r.Risk)
+	switch decideConfirm(r.Risk) {
+	case confirmApprove:
+		printExecCommand(r.Command)
+		return reviewRun, ""
+	case confirmRefuse:
+		fmt.Printf("Not running %q: its risk is %s and the confirm policy is %s.\n", r.Command, r.Risk, confirmPolicy)
+		printRiskRules(r.Risk, r.Rules)
+		r.Refused = true
+		return reviewCancel, ""
+	case confirmDecline:
+		fmt.Printf("Not running %q: it needs confirmation and no user is available.\n", r.Command)
+		r.Refused = true
+		return reviewCancel, ""
+	case confirmNoInput:
+		r.Err = ErrNoInput
+		r.Refused = true
+		return reviewCancel, ""
+	}
+
+	reader := stdinReader()
+	showCommand := true
+
+	for {
+		if showCommand {
+			printConfirmInfo(r.Summary, r.Risk, r.Safer)
+			printRiskRules(r.Risk, r.Rules)
+			printCommandForConfirm(r.Command)
+			showCommand = false
+		}
+
+		risky := isRiskyCommand(r.Risk)
+		fmt.Printf("Run this command? %s: ", r.choices(risky))
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+
+		switch response {
+		case "y", "yes":
+			fmt.Println()
+			return reviewRun, ""
+
+		case "n", "no":
+			return reviewCancel, ""
+
+		case "":
+			// Medium/high risk defaults to No, everything else to Yes
+			if risky {
+				return reviewCancel, ""
+			}
+			fmt.Println()
+			return reviewRun, ""
+
+		case "e", "edit":
+			edited, err := EditCommand(r.Command, reader)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error editing command: %v\n", err)
+				continue
+			}
+			if edited != "" && edited != r.Command {
+				r.Command = edited
+				// The summary and risk no longer describe the edited command,
+				// so only the risk rules rate it
+				r.Summary = ""
+				r.Rules = classifyCommand(edited)
+				r.Risk = combineRisk("", r.Rules)
+			}
+			showCommand = true
+
+		case "r", "refine":
+			if !r.CanRefine {
+				fmt.Println("Refine is not available for this command.")
+				continue
+			}
+			fmt.Print("What should change? ")
+			feedback, _ := reader.ReadString('\n')
+			feedback = strings.TrimSpace(feedback)
+			if feedback == "" {
+				continue
+			}
+			return reviewRefine, feedback
+
+		case "c", "copy":
+			if err := copyToClipboard(r.Command); err != nil {
+				fmt.Fprintf(os.Stderr, "Error copying to clipboard: %v\n", err)
+				continue
+			}
+			fmt.Println("Copied to clipboard.")
+
+		case "x", "explain":
+			if err := r.explain(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error explaining command: %v\n", err)
+			}
+			showCommand = true
+
+		case "?", "h", "help":
+			r.printHelp()
+
+		default:
+			fmt.Printf("Unknown choice %q. Type ? for help.\n", response)
+		}
+	}
+}
+
+// cancelled returns the error for a review that didn't end with running the
+// command, printing that it was cancelled if the user chose to
+func (r *commandReview) cancelled() error {
+	if r.Err != nil {
+		return r.Err
+	}
+	fmt.Println("Cancelled.")
+	return ErrCancelled
+}
+
+// declinedStatus returns the history status of a command that wasn't run
+func (r *commandReview) declinedStatus() string {
+	if r.Refused {
+		return HistoryRefused
+	}
+	return HistoryCancelled
+}
+
+// confirmDecision is what the confirmation policy decides for a command
+type confirmDecision int
+
+const (
+	confirmAsk     confirmDecision = iota // Ask the user
+	confirmApprove                        // Run it without asking
+	confirmRefuse                         // Don't run it
+	confirmNoInput                        // Ask, but there's no terminal to ask on
+	confirmDecline                        // Ask, but nobody can answer (x mcp serve, x serve)
+)
+
+// confirmPolicy decides which confirmations are asked, set by resolveConfirmPolicy
+var confirmPolicy = ConfirmAlwaysAsk
+
+// resolveConfirmPolicy sets the confirmation policy from a global flag, the
+// X_CONFIRM_POLICY variable or the config, in that order
+func resolveConfirmPolicy(flag string) error {
+	policy := flag
+	if policy == "" {
+		policy = os.Getenv(EnvConfirmPolicy)
+	}
+	if policy == "" {
+		if config, err := LoadConfig(); err == nil {
+			policy = config.ConfirmPolicy
+		}
+	}
+	switch policy {
+	case "":
+		policy = ConfirmAlwaysAsk
+	case ConfirmAlwaysAsk, ConfirmAskIfRisky, ConfirmNever, ConfirmDenyRisky, ConfirmNoInput:
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidPolicy, policy)
+	}
+	confirmPolicy = policy
+	return nil
+}
+
+// decideConfirm applies the confirmation policy to a command with the given risk
+func decideConfirm(risk string) confirmDecision {
+	if activeTest != nil {
+		// Command tests answer prompts from their stdin
+		return confirmAsk
+	}
+
+	risky := isRiskyCommand(risk)
+	switch {
+	case confirmPolicy == ConfirmNoInput:
+		return confirmNoInput
+	case confirmPolicy == ConfirmNever:
+		return confirmApprove
+	case confirmPolicy == ConfirmDenyRisky && risky:
+		return confirmRefuse
+	case confirmPolicy == ConfirmDenyRisky, confirmPolicy == ConfirmAskIfRisky && !risky:
+		return confirmApprove
+	}
+
+	// Servers have nobody to ask: --allow-confirm approves what would be asked
+	if unattended {
+		if unattendedApprove {
+			return confirmApprove
+		}
+		return confirmDecline
+	}
+
+	// Reading answers from a pipe or file would hang or guess
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return confirmNoInput
+	}
+	return confirmAsk
+}
+
+// promptFromTerminal makes prompts read from the terminal after piped input
+// was read from stdin, e.g. make 2>&1 | x fix. Without a terminal, stdin is kept.
+func promptFromTerminal() {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return
+	}
+	name := "/dev/tty"
+	if runtime.GOOS == OSWindows {
+		name = "CONIN$"
+	}
+	if tty, err := os.OpenFile(name, os.O_RDWR, 0); err == nil {
+		os.Stdin = tty
+	}
+}
+
+// unattended is set when no user can answer prompts (x mcp serve, x serve).
+// Confirmations the policy would ask are then declined, or approved if
+// unattendedApprove is set.
+var (
+	unattended        bool
+	unattendedApprove bool
+)
+
+// Prompts share one reader so input buffered by one prompt isn't lost to the next
+var (
+	stdinFile   *os.File
+	stdinBuffer *bufio.Reader
+)
+
+// stdinReader returns the shared buffered reader for os.Stdin
+func stdinReader() *bufio.Reader {
+	if stdinBuffer == nil || stdinFile != os.Stdin {
+		stdinFile = os.Stdin
+		stdinBuffer = bufio.NewReader(os.Stdin)
+	}
+	return stdinBuffer
+}
+
+// choices returns the option hint shown in the prompt
+func (r *commandReview) choices(risky bool) string {
+	opts := "Y/n"
+	if risky {
+		opts = "y/N"
+	}
+	opts += "/e"
+	if r.CanRefine {
+		opts += "/r"
+	}
+	return "[" + opts + "/c/x/?]"
+}
+
+// printHelp explains the available choices
+func (r *commandReview) printHelp() {
+	fmt.Println("  y  run the command")
+	fmt.Println("  n  cancel")
+	fmt.Println("  e  edit the command")
+	if r.CanRefine {
+		fmt.Println("  r  refine: describe what should change and regenerate")
+	}
+	fmt.Println("  c  copy the command to the clipboard")
+	fmt.Println("  x  explain the command in detail")
+}
+
+// explain asks the LLM for a detailed explanation of the command and streams it
+func (r *commandReview) explain() error {
+	prompt := "Explain this command:\n\n```\n" + r.Command + "\n```"
+	if r.Summary != "" {
+		prompt += "\n\nIt was generated with this summary: " + r.Summary
+	}
+
+	provider, err := r.providers.Get("", "")
+	if err != nil {
+		return err
+	}
+
+	md := newMarkdownStream()
+	_, err = GenerateResponse(provider, ApplyTemplate(explainSystemPrompt), prompt, md.Write)
+	md.Flush()
+	if errors.Is(err, ErrInterrupted) {
+		printInterrupted()
+		return nil
+	}
+	return err
+}
+
+// confirmAction asks whether to go ahead with a tool action (a file change or
+// MCP tool call) with the given risk. It returns true to go ahead, or the
+// user's feedback if they chose to refine it instead. ErrNoInput is returned
+// when it needs an answer and nobody can give one.
+func confirmAction(question, risk string) (bool, string, error) {
+	switch decideConfirm(risk) {
+	case confirmApprove:
+		return true, "", nil
+	case confirmRefuse:
+		fmt.Printf("Not going ahead: its risk is %s and the confirm policy is %s.\n", risk, confirmPolicy)
+		return false, "", nil
+	case confirmDecline:
+		fmt.Println("Not going ahead: it needs confirmation and no user is available.")
+		return false, "", nil
+	case confirmNoInput:
+		return false, "", ErrNoInput
+	}
+
+	// Medium/high risk defaults to No, everything else to Yes
+	risky := isRiskyCommand(risk)
+	choices := "[Y/n/r/?]"
+	if risky {
+		choices = "[y/N/r/?]"
+	}
+
+	reader := stdinReader()
+	for {
+		fmt.Printf("%s %s: ", question, choices)
+		response, _ := reader.ReadString('\n')
+		switch strings.TrimSpace(strings.ToLower(response)) {
+		case "":
+			if risky {
+				return false, "", nil
+			}
+			fmt.Println()
+			return true, "", nil
+		case "y", "yes":
+			fmt.Println()
+			return true, "", nil
+		case "n", "no":
+			return false, "", nil
+		case "r", "refine":
+			fmt.Print("What should change? ")
+			feedback, _ := reader.ReadString('\n')
+			if feedback = strings.TrimSpace(feedback); feedback != "" {
+				return false, feedback, nil
+			}
+		default:
+			fmt.Println("  y  go ahead")
+			fmt.Println("  n  reject it")
+			fmt.Println("  r  refine: describe what should change instead")
+		}
+	}
+}
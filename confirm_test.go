@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestDecideConfirm(t *testing.T) {
+	defer func() {
+		confirmPolicy = ConfirmAlwaysAsk
+		unattended, unattendedApprove = false, false
+	}()
+
+	// Tests run without a terminal on stdin, so anything that would ask can't
+	tests := []struct {
+		name       string
+		policy     string
+		risk       string
+		unattended bool
+		approve    bool // --allow-confirm
+		want       confirmDecision
+	}{
+		{"always ask", ConfirmAlwaysAsk, "low", false, false, confirmNoInput},
+		{"never", ConfirmNever, "high", false, false, confirmApprove},
+		{"ask if risky, safe", ConfirmAskIfRisky, "low", false, false, confirmApprove},
+		{"ask if risky, risky", ConfirmAskIfRisky, "medium", false, false, confirmNoInput},
+		{"deny risky, safe", ConfirmDenyRisky, "none", false, false, confirmApprove},
+		{"deny risky, risky", ConfirmDenyRisky, "high - deletes files", false, false, confirmRefuse},
+		{"no input", ConfirmNoInput, "none", false, false, confirmNoInput},
+		{"server declines", ConfirmAlwaysAsk, "low", true, false, confirmDecline},
+		{"server with --allow-confirm", ConfirmAlwaysAsk, "high", true, true, confirmApprove},
+		{"--allow-confirm keeps deny-risky", ConfirmDenyRisky, "high", true, true, confirmRefuse},
+		{"--allow-confirm keeps no-input", ConfirmNoInput, "low", true, true, confirmNoInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			confirmPolicy = tt.policy
+			unattended, unattendedApprove = tt.unattended, tt.approve
+			if got := decideConfirm(tt.risk); got != tt.want {
+				t.Errorf("decideConfirm(%q) = %d, want %d", tt.risk, got, tt.want)
+			}
+		})
+	}
+}
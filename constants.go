@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // Version (set via ldflags during build)
 var Version = "dev"
 
@@ -7,34 +9,140 @@ var Version = "dev"
 const (
 	DefaultModelAPI    = "claude-sonnet-4-5-20250929"
 	DefaultModelVertex = "claude-sonnet-4-5@20250929"
+	DefaultModelOpenAI = "gpt-4o"
+	DefaultModelOllama = "llama3.1"
 	DefaultMaxTokens   = 1024
 )
 
+// Default endpoints for OpenAI-compatible and Ollama providers
+const (
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	DefaultOllamaBaseURL = "http://localhost:11434"
+)
+
 // AuthType represents the authentication method
 type AuthType string
 
 const (
 	AuthTypeAPIKey AuthType = "api_key"
 	AuthTypeVertex AuthType = "vertex"
+	AuthTypeOpenAI AuthType = "openai" // OpenAI-compatible Chat Completions (OpenAI, vLLM, LM Studio, llama.cpp)
+	AuthTypeOllama AuthType = "ollama" // Native Ollama API
 )
 
 // Config file names
 const (
-	ConfigFileName          = "config.json"
-	CommandsFileName        = "commands.yaml"
-	LocalCommandsFileName   = "xcommands.yaml"
-	AppConfigDir            = "x"
+	ConfigFileName        = "config.json"
+	CommandsFileName      = "commands.yaml"
+	LocalCommandsFileName = "xcommands.yaml"
+	AppConfigDir          = "x"
+	SessionsDirName       = "sessions"
+	TranscriptsDirName    = "transcripts"     // Saved agentic step conversations
+	RunsFileName          = "runs.jsonl"      // Run history, one run per line
+	HistoryFileName       = "history.jsonl"   // Commands generated by the shell command
+	CompletionCacheFile   = "completion.json" // Commands as completion sees them, in the user cache directory
+	TestsFileSuffix       = ".test.yaml"      // Companion tests file, e.g. xcommands.test.yaml
+)
+
+// Environment variables for offline LLM testing
+const (
+	EnvRecord      = "X_RECORD"             // Directory to save LLM requests/responses as fixtures
+	EnvReplay      = "X_REPLAY"             // Directory to serve LLM responses from instead of calling a provider
+	EnvReplayBySeq = "X_REPLAY_BY_SEQUENCE" // Replay the same call number when a request changed since recording
+	EnvFake        = "X_FAKE_LLM"           // YAML file with scripted LLM responses
+)
+
+// Shell integration (x shell-init)
+const (
+	EnvPrintCommand  = "X_PRINT_COMMAND" // Print commands that need confirmation instead of running them
+	EnvLastCommand   = "X_LAST_COMMAND"  // Last command run in the shell, exported by the hook (x fix)
+	EnvLastStatus    = "X_LAST_STATUS"   // Its exit status
+	DefaultWidgetKey = "ctrl-g"          // Not ctrl-x, which starts key sequences in bash and zsh
+)
+
+// Confirmation policies: when commands that need confirmation are asked about
+const (
+	ConfirmAlwaysAsk  = "always-ask"   // Ask for every command (the default)
+	ConfirmAskIfRisky = "ask-if-risky" // Ask for medium/high risk commands, run the rest
+	ConfirmNever      = "never"        // Run every command without asking (--yes)
+	ConfirmDenyRisky  = "deny-risky"   // Refuse medium/high risk commands, run the rest
+	ConfirmNoInput    = "no-input"     // Fail every confirmation with ErrNoInput (--no-input)
+	EnvConfirmPolicy  = "X_CONFIRM_POLICY"
+	ToolActionRisk    = "medium" // Risk of agent file changes and MCP tool calls
+)
+
+// Exit codes. A failed exec step exits with its command's exit code instead,
+// which takes precedence and can be any of these.
+const (
+	ExitCodeError       = 1   // Any other error
+	ExitCodeLLM         = 69  // An LLM provider request failed (EX_UNAVAILABLE)
+	ExitCodeCancelled   = 75  // A confirmation was declined, refused or couldn't be asked (EX_TEMPFAIL)
+	ExitCodeAuth        = 77  // The LLM provider rejected the credentials (EX_NOPERM)
+	ExitCodeConfig      = 78  // Invalid or missing configuration (EX_CONFIG)
+	ExitCodeTimeout     = 124 // A request or command timed out, like timeout(1)
+	ExitCodeInterrupted = 130 // Ctrl-C, like a shell (128 + SIGINT)
+)
+
+// Global flags (before the command) and the environment variables they override
+const (
+	FlagDryRun     = "--dry-run"
+	FlagDebug      = "--debug"
+	FlagModel      = "--model"
+	FlagQuiet      = "--quiet"
+	FlagQuietShort = "-q"
+	FlagJSON       = "--json"
+	FlagOutput     = "--output"
+	FlagYes        = "--yes"
+	FlagYesShort   = "-y"
+	FlagNoInput    = "--no-input"
+	EnvDryRun      = "DRYRUN"
+	EnvDebug       = "DEBUG"
+	EnvNoColor     = "NO_COLOR"
+)
+
+// Output formats (--output)
+const (
+	OutputText  = "text"  // Human-readable (the default)
+	OutputJSON  = "json"  // A JSON object with the result when the command finishes (--json)
+	OutputJSONL = "jsonl" // A JSON line for each event as the command runs
+)
+
+// HTTP API (x serve)
+const (
+	DefaultServeAddr = "127.0.0.1:8765"
+	EnvServeToken    = "X_SERVE_TOKEN" // Bearer token required by x serve
+	MaxServeRuns     = 100             // Finished runs kept in memory
+	MaxServeOutput   = 1 << 20         // Output kept per run; the rest is dropped
 )
 
 // Command names (reserved - cannot be used as custom command names)
 const (
-	CmdConfigure = "configure"
-	CmdCommands  = "commands"
-	CmdUsage     = "usage"
-	CmdUpgrade   = "upgrade"
-	CmdVersion   = "version"
+	CmdConfigure  = "configure"
+	CmdCommands   = "commands"
+	CmdUsage      = "usage"
+	CmdUpgrade    = "upgrade"
+	CmdVersion    = "version"
+	CmdChat       = "chat"
+	CmdMCP        = "mcp"
+	CmdServe      = "serve"
+	CmdRuns       = "runs"
+	CmdHistory    = "history"
+	CmdShellInit  = "shell-init"
+	CmdCompletion = "completion"
+	CmdExplain    = "explain"
+	CmdComplete   = "__complete" // Called by completion scripts
+)
+
+// Built-in commands
+const (
+	ShellCommand  = "shell"    // Generates shell commands; the default command
+	FixCommand    = "fix"      // Corrects the last failed shell command
+	BuiltinSource = "built-in" // Source of built-in commands
 )
 
+// GroupSeparator joins a command group and the commands in it, e.g. db:migrate
+const GroupSeparator = ":"
+
 // GitHub repository
 const (
 	GitHubOwner = "priyanshu-shubham"
@@ -83,6 +191,40 @@ const (
 const (
 	DefaultMaxIterations = 10
 	AgenticMaxTokens     = 4096
+	ChatMaxTokens        = 4096
 	ToolShell            = "shell"
 	ToolComplete         = "complete"
+	ToolReadFile         = "read_file"
+	ToolWriteFile        = "write_file"
+	ToolEditFile         = "edit_file"
+	ToolListDir          = "list_dir"
+	ToolGlob             = "glob"
+	ToolGrep             = "grep"
+	ToolAskUser          = "ask_user"
 )
+
+// Limits on what file tools return to the model
+const (
+	MaxReadLines   = 2000
+	MaxReadBytes   = 256 << 10 // read_file stops after this much output
+	MaxListEntries = 500
+	MaxGrepMatches = 200
+	MaxGrepFile    = 1 << 20 // Larger files are skipped by grep
+	MaxLineLength  = 500     // Longer lines are truncated in tool results
+)
+
+// ShowResultLines is how many lines of each tool result x runs show prints
+const ShowResultLines = 10
+
+// DefaultRunsLimit is how many runs x runs lists by default
+const DefaultRunsLimit = 20
+
+// DefaultHistoryLimit is how many commands x history lists by default
+const DefaultHistoryLimit = 20
+
+// CompletionCandidatesTTL is how long the lines printed for a command:
+// completion hint are reused before the command runs again
+const CompletionCandidatesTTL = 30 * time.Second
+
+// MaxFixOutputLines is how much of a failed command's output x fix sends, from the end
+const MaxFixOutputLines = 100
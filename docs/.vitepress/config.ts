@@ -51,7 +51,13 @@ export default defineConfig({
           text: 'Configuration',
           items: [
             { text: 'Variables', link: '/reference/variables' },
-            { text: 'Config Files', link: '/reference/config-files' }
+            { text: 'Config Files', link: '/reference/config-files' },
+            { text: 'LLM Providers', link: '/reference/providers' },
+            { text: 'Testing Commands', link: '/reference/testing' },
+            { text: 'Run History', link: '/reference/run-history' },
+            { text: 'MCP Server', link: '/reference/mcp-server' },
+            { text: 'HTTP API', link: '/reference/http-api' },
+            { text: 'Scripting', link: '/reference/scripting' }
           ]
         }
       ],
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 )
 
 // Common editor names to try on Linux/Unix
@@ -63,3 +66,49 @@ func findEditor() string {
 
 	return ""
 }
+
+// EditCommand lets the user edit a shell command.
+// Opens the command in $EDITOR (or a fallback editor) when one is available,
+// otherwise asks for a replacement inline. Returns the edited command.
+func EditCommand(command string, reader *bufio.Reader) (string, error) {
+	editor := findEditor()
+	if editor == "" {
+		fmt.Println("No editor found; type the new command (empty to keep it):")
+		fmt.Print("> ")
+		line, _ := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return command, nil
+		}
+		return line, nil
+	}
+
+	file, err := os.CreateTemp("", "x-command-*.sh")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(command + "\n"); err != nil {
+		file.Close()
+		return "", err
+	}
+	file.Close()
+
+	// $EDITOR may include arguments (e.g. "code -w")
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -1,6 +1,10 @@
 package main
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
 // Configuration errors
 var (
@@ -10,4 +14,97 @@ var (
 	ErrInvalidAuthType  = errors.New("invalid authentication type")
 	ErrInvalidChoice    = errors.New("invalid choice")
 	ErrNoEditorFound    = errors.New("no editor found; set $EDITOR environment variable")
+	ErrNoClipboard      = errors.New("no clipboard program found (install wl-copy, xclip or xsel)")
+	ErrNotConfigured    = errors.New("no LLM provider configured; run 'x configure'")
+	ErrUnknownProvider  = errors.New("unknown provider")
+	ErrUnknownTool      = errors.New("unknown tool")
+	ErrUnknownMCPServer = errors.New("unknown MCP server")
+	ErrInvalidPolicy    = errors.New("invalid confirm policy (use always-ask, ask-if-risky, never, deny-risky or no-input)")
 )
+
+// Execution errors
+var (
+	ErrInterrupted        = errors.New("interrupted")
+	ErrCancelled          = errors.New("cancelled")
+	ErrCommandPrinted     = errors.New("command printed instead of run")
+	ErrNoInput            = errors.New("confirmation needed but no one can answer (--no-input, or stdin is not a terminal); use --yes or X_CONFIRM_POLICY to decide without asking")
+	ErrSessionNotFound    = errors.New("no chat session found")
+	ErrTranscriptNotFound = errors.New("no agent transcript found")
+	ErrRunNotFound        = errors.New("no run found")
+	ErrFixtureNotFound    = errors.New("no recorded LLM response")
+	ErrNoScripted         = errors.New("no scripted LLM response")
+	ErrTestsFailed        = errors.New("tests failed")
+	ErrNoTests            = errors.New("no command tests found")
+	ErrUnmockedExec       = errors.New("shell command isn't mocked; mock it under mock.exec or set allow_exec: true")
+)
+
+// StepError is a pipeline step that failed. Err is what the step returned,
+// e.g. an *exec.ExitError for a failed exec step.
+type StepError struct {
+	Step int    // 1-based position in the command
+	ID   string // Step ID, or step-N
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError is a problem with a commands config or x's configuration
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// LLMError is a failed request to an LLM provider
+type LLMError struct {
+	Provider   string
+	StatusCode int // HTTP status, or 0 if there was no response
+	Err        error
+}
+
+func (e *LLMError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *LLMError) Unwrap() error {
+	return e.Err
+}
+
+// isAuth reports whether the provider rejected the credentials
+func (e *LLMError) isAuth() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// ExitStatusError is a command that exited with a non-zero status without an
+// *exec.ExitError, such as a mocked command in a command test
+type ExitStatusError struct {
+	Code int
+}
+
+func (e *ExitStatusError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit status, like *exec.ExitError
+func (e *ExitStatusError) ExitCode() int {
+	return e.Code
+}
+
+// exitCoder is an error carrying a command's exit status: an *exec.ExitError
+// or an *ExitStatusError
+type exitCoder interface {
+	error
+	ExitCode() int
+}
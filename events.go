@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types of the --output jsonl stream
+const (
+	EventStepStarted     = "step_started"
+	EventStepFinished    = "step_finished"
+	EventLLMText         = "llm_text"
+	EventToolCall        = "tool_call"
+	EventConfirmRequired = "confirm_required"
+	EventExecOutput      = "exec_output"
+	EventExecFinished    = "exec_finished"
+	EventRunFinished     = "run_finished"
+)
+
+// runEvent is a line of the --output jsonl stream
+type runEvent struct {
+	Type     string          `json:"type"`
+	Time     time.Time       `json:"time"`
+	Step     string          `json:"step,omitempty"`      // Innermost running step, e.g. deploy.build
+	StepType string          `json:"step_type,omitempty"` // exec, llm, agentic or subcommand (step_started)
+	Command  string          `json:"command,omitempty"`   // Shell command, or the command run (run_finished)
+	Text     string          `json:"text,omitempty"`      // Streamed model text or command output
+	Tool     string          `json:"tool,omitempty"`
+	Input    json.RawMessage `json:"input,omitempty"` // Tool input
+	Summary  string          `json:"summary,omitempty"`
+	Risk     string          `json:"risk,omitempty"`
+	ExitCode *int            `json:"exit_code,omitempty"`
+	Status   string          `json:"status,omitempty"` // step_finished and run_finished
+	Error    string          `json:"error,omitempty"`
+	Output   string          `json:"output,omitempty"`
+	Usage    *TokenUsage     `json:"usage,omitempty"`
+}
+
+// eventStream collects what happens during a command run with --json or
+// --output jsonl. With jsonl, each event is written as a line of JSON.
+type eventStream struct {
+	mu     sync.Mutex
+	enc    *json.Encoder // Where streamed events are written
+	steps  []string      // Running steps, innermost last
+	usage  TokenUsage
+	stream bool
+}
+
+// activeEvents is the event stream of the command being run, or nil. Its
+// methods are nil-safe so pipelines can emit events unconditionally.
+var activeEvents *eventStream
+
+// newEventStream creates an event stream, writing events to w if stream is set
+func newEventStream(w io.Writer, stream bool) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w), stream: stream}
+}
+
+// emit writes an event, in the innermost running step unless it names one
+func (e *eventStream) emit(event runEvent) {
+	if e == nil || !e.stream {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	event.Time = time.Now()
+	if event.Step == "" && len(e.steps) > 0 {
+		event.Step = e.steps[len(e.steps)-1]
+	}
+	e.enc.Encode(event)
+}
+
+// stepStarted emits step_started and makes the step the current one
+func (e *eventStream) stepStarted(name, stepType string) {
+	if e == nil {
+		return
+	}
+	e.emit(runEvent{Type: EventStepStarted, Step: name, StepType: stepType})
+	e.mu.Lock()
+	e.steps = append(e.steps, name)
+	e.mu.Unlock()
+}
+
+// stepFinished emits step_finished for the innermost running step
+func (e *eventStream) stepFinished(err error) {
+	if e == nil || len(e.steps) == 0 {
+		return
+	}
+	event := runEvent{Type: EventStepFinished, Status: runStatus(err)}
+	if event.Status == RunFailed {
+		event.Error = err.Error()
+	}
+	e.emit(event)
+	e.mu.Lock()
+	e.steps = e.steps[:len(e.steps)-1]
+	e.mu.Unlock()
+}
+
+// llmText emits a chunk of streamed model text
+func (e *eventStream) llmText(text string) {
+	e.emit(runEvent{Type: EventLLMText, Text: text})
+}
+
+// toolCall emits a tool call made by an agent
+func (e *eventStream) toolCall(name string, input json.RawMessage) {
+	e.emit(runEvent{Type: EventToolCall, Tool: name, Input: input})
+}
+
+// confirmRequired emits a command that needs confirmation, before the
+// confirm policy or the user decides
+func (e *eventStream) confirmRequired(command, summary, risk string) {
+	e.emit(runEvent{Type: EventConfirmRequired, Command: command, Summary: summary, Risk: risk})
+}
+
+// execFinished emits the exit code of a shell command that ran
+func (e *eventStream) execFinished(command string, err error) {
+	code := exitCode(err)
+	e.emit(runEvent{Type: EventExecFinished, Command: command, ExitCode: &code})
+}
+
+// outputWriter returns a writer that emits a shell command's output as
+// exec_output events, or io.Discard when there is no stream
+func (e *eventStream) outputWriter(command string) io.Writer {
+	if e == nil || !e.stream {
+		return io.Discard
+	}
+	return execOutputWriter{e, command}
+}
+
+// execOutputWriter emits what it's given as exec_output events
+type execOutputWriter struct {
+	events  *eventStream
+	command string
+}
+
+func (w execOutputWriter) Write(p []byte) (int, error) {
+	w.events.emit(runEvent{Type: EventExecOutput, Command: w.command, Text: string(p)})
+	return len(p), nil
+}
+
+// addUsage adds the tokens used by a model response
+func (e *eventStream) addUsage(usage TokenUsage) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.usage.InputTokens += usage.InputTokens
+	e.usage.OutputTokens += usage.OutputTokens
+	e.usage.CacheCreationTokens += usage.CacheCreationTokens
+	e.usage.CacheReadTokens += usage.CacheReadTokens
+}
+
+// runFinished emits run_finished with the command's result and token usage
+func (e *eventStream) runFinished(result jsonResult) {
+	e.emit(runEvent{
+		Type:     EventRunFinished,
+		Command:  result.Command,
+		Status:   result.Status,
+		ExitCode: &result.ExitCode,
+		Output:   result.Output,
+		Error:    result.Error,
+		Usage:    result.Usage,
+	})
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// explainCommandSystemPrompt asks for a per-segment explanation of a command,
+// with the same risk levels the shell command uses
+const explainCommandSystemPrompt = `You explain shell commands to a user who found one (in a runbook, a chat, a script) and wants to understand it before running it.
+Environment: {{os}}, {{arch}}, {{directory}}, {{shell}}
+
+The command has been split into segments: the commands joined by pipes, &&, || or ;.
+
+OUTPUT FORMAT: Return a JSON object with these fields:
+{
+  "explanation": "<markdown: one sentence on what the whole command does, then one bullet per segment with the segment in backticks, what it does, and what each flag and argument means>",
+  "summary": "<one-line description of what the command does>",
+  "risk": "<none|low|medium|high> - <brief reason if not none>",
+  "safer": "<alternative command if risk is medium/high, empty string if not needed>"
+}
+
+RISK LEVELS:
+- none: Read-only, informational (ls, cat, grep, ps, echo)
+- low: Minor changes, easily reversible (touch, mkdir, git add)
+- medium: Significant changes, hard to undo (rm files, git reset, package install)
+- high: Destructive/irreversible (rm -rf, kill -9, drop table, format)
+
+Point out side effects, anything destructive or irreversible, and anything that depends on the environment (paths, variables, sudo, network).
+
+OUTPUT ONLY THE JSON OBJECT. No markdown around it, no extra text.`
+
+// commandSegment is one command of a pipeline or command list
+type commandSegment struct {
+	Text     string   // The segment as written
+	Words    []string // Its words, with quotes removed
+	Operator string   // What joins it to the next segment (|, &&, ||, ;, &), "" for the last
+}
+
+// commandExplanation is the LLM's explanation of a command
+type commandExplanation struct {
+	Explanation string `json:"explanation"`
+	Summary     string `json:"summary"`
+	Risk        string `json:"risk"`
+	Safer       string `json:"safer"`
+}
+
+// RunExplain handles: x explain [--run] [command]
+// Without a command, it's read from stdin, so a one-liner can be pasted as is.
+func RunExplain(providers *Providers, opts RunOptions, args []string) (err error) {
+	run := false
+	if len(args) > 0 && args[0] == "--run" {
+		run = true
+		args = args[1:]
+	}
+
+	command := strings.TrimSpace(strings.Join(args, " "))
+	if command == "" {
+		if command, err = readCommandToExplain(); err != nil {
+			return err
+		}
+	}
+	if command == "" {
+		return fmt.Errorf("usage: x %s [--run] '<command>'", CmdExplain)
+	}
+
+	if r := beginRun(Command{Name: CmdExplain, Source: BuiltinSource}, []string{command}, opts); r != nil {
+		defer func() { r.end(err) }()
+	}
+
+	segments := splitCommandSegments(command)
+	explanation, err := explainCommand(providers, command, segments, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	renderMarkdown(explanation.Explanation)
+
+	if !run || opts.DryRun {
+		rules := classifyCommand(command)
+		risk := combineRisk(explanation.Risk, rules)
+		printConfirmInfo(explanation.Summary, risk, explanation.Safer)
+		printRiskRules(risk, rules)
+		return nil
+	}
+
+	review := newCommandReview(providers, command, explanation.Summary, explanation.Risk, explanation.Safer)
+	if outcome, _ := review.Prompt(); outcome != reviewRun {
+		return review.cancelled()
+	}
+
+	activeRun.startStep(CmdExplain+".run", "exec")
+	err = RunShellCommand(review.Command)
+	activeRun.recordExec(review.Command, true, err)
+	activeRun.endStep(err)
+	return err
+}
+
+// readCommandToExplain reads the command from stdin: piped in, or typed
+// (pasted) at a prompt
+func readCommandToExplain() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := io.ReadAll(os.Stdin)
+		promptFromTerminal()
+		return strings.TrimSpace(string(data)), err
+	}
+
+	fmt.Print("Command to explain: ")
+	line, err := stdinReader().ReadString('\n')
+	if err != nil && line == "" {
+		return "", nil
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// explainCommand asks the LLM to explain a command segment by segment
+func explainCommand(providers *Providers, command string, segments []commandSegment, opts RunOptions) (*commandExplanation, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Command:\n%s\n\nSegments:\n", command)
+	for i, seg := range segments {
+		fmt.Fprintf(&prompt, "%d. %s\n", i+1, seg.Text)
+		if len(seg.Words) > 0 {
+			fmt.Fprintf(&prompt, "   program: %s", seg.Words[0])
+			var flags, operands []string
+			for _, word := range seg.Words[1:] {
+				if strings.HasPrefix(word, "-") && word != "-" {
+					flags = append(flags, word)
+				} else {
+					operands = append(operands, word)
+				}
+			}
+			if len(flags) > 0 {
+				fmt.Fprintf(&prompt, "; flags: %s", strings.Join(flags, " "))
+			}
+			if len(operands) > 0 {
+				fmt.Fprintf(&prompt, "; arguments: %s", strings.Join(operands, " "))
+			}
+			prompt.WriteString("\n")
+		}
+		if seg.Operator != "" {
+			fmt.Fprintf(&prompt, "   followed by: %s\n", seg.Operator)
+		}
+	}
+
+	systemPrompt := ApplyTemplate(explainCommandSystemPrompt)
+	debugPrompt("System prompt", systemPrompt)
+	debugPrompt("User prompt", prompt.String())
+
+	if opts.DryRun {
+		fmt.Println("[DRYRUN] Would call LLM with:")
+		fmt.Println("[DRYRUN]   System prompt length:", len(systemPrompt), "bytes")
+		fmt.Println("[DRYRUN]   User prompt length:", prompt.Len(), "bytes")
+		return &commandExplanation{Explanation: "[dry run - no LLM response]"}, nil
+	}
+
+	provider, err := providers.ForStep(CmdExplain, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	tty := term.IsTerminal(int(os.Stdout.Fd()))
+	if tty {
+		fmt.Print(ansiDim + "Explaining..." + ansiReset)
+	}
+	response, err := GenerateResponse(provider, systemPrompt, prompt.String(), nil)
+	if tty {
+		fmt.Print("\r\033[K")
+	}
+	if errors.Is(err, ErrInterrupted) {
+		printInterrupted()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var explanation commandExplanation
+	if err := json.Unmarshal([]byte(stripMarkdownCodeBlock(response)), &explanation); err != nil {
+		// Not JSON: show the answer as the explanation, without a risk level
+		debugLog("Explanation is not JSON: %v", err)
+		return &commandExplanation{Explanation: response}, nil
+	}
+	return &explanation, nil
+}
+
+// splitCommandSegments splits a command line at pipes and command separators
+// that aren't quoted, escaped or inside $(...) or backticks
+func splitCommandSegments(command string) []commandSegment {
+	var segments []commandSegment
+	var text, word strings.Builder
+	var words []string
+	var quote rune // ' or " while inside quotes
+	depth := 0     // Nesting of $( )
+	backtick := false
+	inWord := false
+
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endSegment := func(operator string) {
+		endWord()
+		if t := strings.TrimSpace(text.String()); t != "" {
+			segments = append(segments, commandSegment{Text: t, Words: words, Operator: operator})
+		}
+		text.Reset()
+		words = nil
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case quote != 0:
+			// Inside quotes everything is part of the word
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && next != 0 {
+				word.WriteRune(next)
+				text.WriteRune(c)
+				c = next
+				i++
+			} else {
+				word.WriteRune(c)
+			}
+
+		case c == '\\' && next != 0:
+			text.WriteRune(c)
+			word.WriteRune(next)
+			inWord = true
+			c = next
+			i++
+
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+
+		case c == '$' && next == '(':
+			depth++
+			word.WriteRune(c)
+			inWord = true
+
+		case c == '`':
+			backtick = !backtick
+			word.WriteRune(c)
+			inWord = true
+
+		case c == ')' && depth > 0:
+			depth--
+			word.WriteRune(c)
+
+		case depth > 0 || backtick:
+			word.WriteRune(c)
+			inWord = true
+
+		case (c == '&' || c == '|') && i > 0 && (runes[i-1] == '>' || runes[i-1] == '<'),
+			c == '&' && next == '>':
+			// Redirections like 2>&1, >| and &>, not separators
+			word.WriteRune(c)
+			inWord = true
+
+		case c == '|' || c == '&' || c == ';':
+			operator := string(c)
+			if (c == '|' || c == '&') && next == c || c == '|' && next == '&' {
+				operator += string(next)
+				i++
+			}
+			endSegment(operator)
+			continue
+
+		case c == ' ' || c == '\t' || c == '\n':
+			endWord()
+
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+		text.WriteRune(c)
+	}
+	endSegment("")
+
+	// The last segment has no operator after it
+	if n := len(segments); n > 0 && segments[n-1].Operator == ";" {
+		segments[n-1].Operator = ""
+	}
+	return segments
+}
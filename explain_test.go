@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandSegments(t *testing.T) {
+	// seg builds a segment with its words
+	seg := func(text, operator string, words ...string) commandSegment {
+		return commandSegment{Text: text, Words: words, Operator: operator}
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		want    []commandSegment
+	}{
+		{"single command", "ls -la", []commandSegment{seg("ls -la", "", "ls", "-la")}},
+		{"pipe", "ps aux | grep go", []commandSegment{
+			seg("ps aux", "|", "ps", "aux"),
+			seg("grep go", "", "grep", "go"),
+		}},
+		{"and, or, semicolon", "make && make test || echo failed; echo done", []commandSegment{
+			seg("make", "&&", "make"),
+			seg("make test", "||", "make", "test"),
+			seg("echo failed", ";", "echo", "failed"),
+			seg("echo done", "", "echo", "done"),
+		}},
+		{"trailing semicolon", "ls;", []commandSegment{seg("ls", "", "ls")}},
+		{"background", "sleep 5 & echo started", []commandSegment{
+			seg("sleep 5", "&", "sleep", "5"),
+			seg("echo started", "", "echo", "started"),
+		}},
+		{"pipe with stderr", "make |& tee log", []commandSegment{
+			seg("make", "|&", "make"),
+			seg("tee log", "", "tee", "log"),
+		}},
+		{"single quotes", `echo 'a | b; c'`, []commandSegment{seg(`echo 'a | b; c'`, "", "echo", "a | b; c")}},
+		{"double quotes with escapes", `echo "say \"hi\" && bye"`, []commandSegment{seg(`echo "say \"hi\" && bye"`, "", "echo", `say "hi" && bye`)}},
+		{"escaped separator", `echo a \; b`, []commandSegment{seg(`echo a \; b`, "", "echo", "a", ";", "b")}},
+		{"escaped space", `cat my\ file`, []commandSegment{seg(`cat my\ file`, "", "cat", "my file")}},
+		{"empty quotes", `grep "" file`, []commandSegment{seg(`grep "" file`, "", "grep", "", "file")}},
+		{"command substitution", "echo $(ls | wc -l) && pwd", []commandSegment{
+			seg("echo $(ls | wc -l)", "&&", "echo", "$(ls | wc -l)"),
+			seg("pwd", "", "pwd"),
+		}},
+		{"nested substitution", "echo $(dirname $(pwd)); ls", []commandSegment{
+			seg("echo $(dirname $(pwd))", ";", "echo", "$(dirname $(pwd))"),
+			seg("ls", "", "ls"),
+		}},
+		{"backticks", "echo `ls | head -1` | wc", []commandSegment{
+			seg("echo `ls | head -1`", "|", "echo", "`ls | head -1`"),
+			seg("wc", "", "wc"),
+		}},
+		{"stderr to stdout", "make 2>&1 | less", []commandSegment{
+			seg("make 2>&1", "|", "make", "2>&1"),
+			seg("less", "", "less"),
+		}},
+		{"both streams", "make &> build.log", []commandSegment{seg("make &> build.log", "", "make", "&>", "build.log")}},
+		{"clobber", "echo hi >| out.txt", []commandSegment{seg("echo hi >| out.txt", "", "echo", "hi", ">|", "out.txt")}},
+		{"input from stdin fd", "cat <&3", []commandSegment{seg("cat <&3", "", "cat", "<&3")}},
+		{"empty", "", nil},
+		{"only separators", " ; ; ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitCommandSegments(tt.command)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommandSegments(%q) =\n%#v\nwant\n%#v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
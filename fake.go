@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scriptedScript is a YAML file of canned LLM responses (X_FAKE_LLM)
+type scriptedScript struct {
+	Responses []*scriptedResponse `yaml:"responses"`
+
+	mu sync.Mutex
+}
+
+// scriptedResponse is a canned response, used for the first request it matches
+type scriptedResponse struct {
+	Step      string             `yaml:"step"`       // Step id or "command.step" (empty matches any step)
+	Match     string             `yaml:"match"`      // Regexp the latest user message must match
+	Text      string             `yaml:"text"`       // Response text
+	ToolCalls []scriptedToolCall `yaml:"tool_calls"` // Tool calls to make (agentic steps)
+	Repeat    bool               `yaml:"repeat"`     // Can be used more than once
+
+	re   *regexp.Regexp
+	used bool
+}
+
+// scriptedToolCall is a tool call in a scripted response
+type scriptedToolCall struct {
+	Name  string         `yaml:"name"`
+	Input map[string]any `yaml:"input"`
+}
+
+// loadScript reads a scripted responses file
+func loadScript(path string) (*scriptedScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var script scriptedScript
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("invalid script %s: %w", path, err)
+	}
+
+	if err := script.compile(); err != nil {
+		return nil, fmt.Errorf("invalid script %s: %w", path, err)
+	}
+
+	return &script, nil
+}
+
+// compile compiles the match patterns of the responses
+func (s *scriptedScript) compile() error {
+	for i, r := range s.Responses {
+		if r.Match == "" {
+			continue
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("invalid match pattern in response %d: %w", i+1, err)
+		}
+		r.re = re
+	}
+	return nil
+}
+
+// next returns the first unused response matching the step and latest user message
+func (s *scriptedScript) next(step, message string) (*scriptedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.Responses {
+		if r.used || !stepMatches(r.Step, step) {
+			continue
+		}
+		if r.re != nil && !r.re.MatchString(message) {
+			continue
+		}
+		if !r.Repeat {
+			r.used = true
+		}
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("%w for step %s", ErrNoScripted, step)
+}
+
+// ScriptedProvider answers requests from a script instead of a model
+type ScriptedProvider struct {
+	script *scriptedScript
+	step   string
+}
+
+// Name returns the provider type
+func (p *ScriptedProvider) Name() string {
+	return "fake"
+}
+
+// DefaultModel returns an empty model
+func (p *ScriptedProvider) DefaultModel() string {
+	return ""
+}
+
+// Complete returns the next scripted response for the step
+func (p *ScriptedProvider) Complete(ctx context.Context, req CompletionRequest, onText func(string)) (*CompletionResponse, error) {
+	r, err := p.script.next(p.step, lastUserText(req.Messages))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &CompletionResponse{StopReason: StopEndTurn}
+	if r.Text != "" {
+		resp.Content = append(resp.Content, ContentBlock{Type: BlockText, Text: r.Text})
+		if onText != nil {
+			onText(r.Text)
+		}
+	}
+
+	for i, call := range r.ToolCalls {
+		input, err := json.Marshal(call.Input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input for scripted tool call %s: %w", call.Name, err)
+		}
+		if call.Input == nil {
+			input = json.RawMessage("{}")
+		}
+		resp.Content = append(resp.Content, ContentBlock{
+			Type:     BlockToolUse,
+			ToolID:   fmt.Sprintf("call_%d", i),
+			ToolName: call.Name,
+			Input:    input,
+		})
+		resp.StopReason = StopToolUse
+	}
+
+	return resp, ctx.Err()
+}
+
+// lastUserText returns the text and tool results of the latest user message
+func lastUserText(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != RoleUser {
+			continue
+		}
+		var parts []string
+		for _, block := range messages[i].Content {
+			if block.Text != "" {
+				parts = append(parts, block.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
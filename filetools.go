@@ -0,0 +1,614 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// GetReadFileTool returns the read_file tool definition
+func GetReadFileTool() ToolDef {
+	return ToolDef{
+		Name: ToolReadFile,
+		Description: fmt.Sprintf(`Read a text file. Lines are returned with line numbers (not part of the file).
+Use offset and limit to read part of a large file. At most %d lines or %d KB are returned at once.`, MaxReadLines, MaxReadBytes>>10),
+		Properties: map[string]any{
+			"path":   map[string]any{"type": "string", "description": "File path (relative to the current directory, ~ for home)"},
+			"offset": map[string]any{"type": "integer", "description": "First line to read (1-based, default 1)"},
+			"limit":  map[string]any{"type": "integer", "description": fmt.Sprintf("Number of lines to read (default and maximum %d)", MaxReadLines)},
+		},
+		Required: []string{"path"},
+	}
+}
+
+// GetWriteFileTool returns the write_file tool definition
+func GetWriteFileTool() ToolDef {
+	return ToolDef{
+		Name: ToolWriteFile,
+		Description: `Create or overwrite a file with the given content, or append to it.
+The user sees a diff and may be asked to approve it. Prefer edit_file for small changes to existing files.`,
+		Properties: map[string]any{
+			"path":    map[string]any{"type": "string", "description": "File path (relative to the current directory, ~ for home)"},
+			"content": map[string]any{"type": "string", "description": "The full file content, or the text to append"},
+			"append":  map[string]any{"type": "boolean", "description": "Append content to the end of the file instead of replacing it"},
+		},
+		Required: []string{"path", "content"},
+	}
+}
+
+// GetEditFileTool returns the edit_file tool definition
+func GetEditFileTool() ToolDef {
+	return ToolDef{
+		Name: ToolEditFile,
+		Description: `Edit a file by replacing exact text. old_string must match the file exactly (including indentation)
+and occur once, unless replace_all is set. Include enough surrounding lines to make it unique.
+The user sees a diff and may be asked to approve it.`,
+		Properties: map[string]any{
+			"path":        map[string]any{"type": "string", "description": "File path (relative to the current directory, ~ for home)"},
+			"old_string":  map[string]any{"type": "string", "description": "Exact text to replace"},
+			"new_string":  map[string]any{"type": "string", "description": "Replacement text"},
+			"replace_all": map[string]any{"type": "boolean", "description": "Replace every occurrence"},
+		},
+		Required: []string{"path", "old_string", "new_string"},
+	}
+}
+
+// GetListDirTool returns the list_dir tool definition
+func GetListDirTool() ToolDef {
+	return ToolDef{
+		Name:        ToolListDir,
+		Description: "List the entries of a directory. Directories end with /.",
+		Properties: map[string]any{
+			"path": map[string]any{"type": "string", "description": "Directory path (default: current directory)"},
+		},
+	}
+}
+
+// GetGlobTool returns the glob tool definition
+func GetGlobTool() ToolDef {
+	return ToolDef{
+		Name:        ToolGlob,
+		Description: "Find files whose path matches a glob pattern, e.g. **/*.go or src/*.ts. * matches within a directory, ** across directories.",
+		Properties: map[string]any{
+			"pattern": map[string]any{"type": "string", "description": "Glob pattern, relative to path"},
+			"path":    map[string]any{"type": "string", "description": "Directory to search (default: current directory)"},
+		},
+		Required: []string{"pattern"},
+	}
+}
+
+// GetGrepTool returns the grep tool definition
+func GetGrepTool() ToolDef {
+	return ToolDef{
+		Name:        ToolGrep,
+		Description: "Search file contents with a regular expression (Go syntax). Returns matching lines as path:line: text.",
+		Properties: map[string]any{
+			"pattern":     map[string]any{"type": "string", "description": "Regular expression to search for"},
+			"path":        map[string]any{"type": "string", "description": "File or directory to search (default: current directory)"},
+			"glob":        map[string]any{"type": "string", "description": "Only search files matching this glob, e.g. **/*.go"},
+			"ignore_case": map[string]any{"type": "boolean", "description": "Case-insensitive search"},
+		},
+		Required: []string{"pattern"},
+	}
+}
+
+// GetAskUserTool returns the ask_user tool definition
+func GetAskUserTool() ToolDef {
+	return ToolDef{
+		Name:        ToolAskUser,
+		Description: "Ask the user a question and wait for their answer. Use it when a choice or missing information can't be worked out otherwise.",
+		Properties: map[string]any{
+			"question": map[string]any{"type": "string", "description": "The question to ask"},
+		},
+		Required: []string{"question"},
+	}
+}
+
+// handleReadFile processes a read_file tool call
+func handleReadFile(tc *toolContext, input json.RawMessage) (string, bool) {
+	var params struct {
+		Path   string `json:"path"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return fmt.Sprintf("Error parsing tool input: %v", err), true
+	}
+
+	path, err := resolveToolPath(params.Path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	defer file.Close()
+
+	r := bufio.NewReaderSize(file, 8000)
+	if head, _ := r.Peek(8000); isBinary(head) {
+		return fmt.Sprintf("Error: %s is a binary file", params.Path), true
+	}
+
+	start := max(params.Offset, 1)
+	limit := params.Limit
+	if limit <= 0 || limit > MaxReadLines {
+		limit = MaxReadLines
+	}
+
+	detail := params.Path
+	if params.Offset > 0 || params.Limit > 0 {
+		detail += fmt.Sprintf(" (from line %d)", start)
+	}
+	printToolAction("Reading", detail)
+
+	// Read only the requested lines, so large files aren't loaded whole
+	var out strings.Builder
+	n, more := 0, false
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if err != io.EOF {
+				return fmt.Sprintf("Error: %v", err), true
+			}
+			break
+		}
+		n++
+		if n < start {
+			continue
+		}
+		if n >= start+limit || out.Len() >= MaxReadBytes {
+			more = true
+			n--
+			break
+		}
+		fmt.Fprintf(&out, "%6d\t%s\n", n, truncateLine(line))
+	}
+
+	switch {
+	case n == 0:
+		return "(empty file)", false
+	case start > n:
+		return fmt.Sprintf("Error: offset %d is past the end of the file (%d lines)", start, n), true
+	case more:
+		fmt.Fprintf(&out, "(lines %d-%d; the file continues, read more with offset %d)\n", start, n, n+1)
+	case start > 1:
+		fmt.Fprintf(&out, "(lines %d-%d of %d)\n", start, n, n)
+	}
+	return out.String(), false
+}
+
+// readLine reads a line without its line ending. Only the start of a very
+// long line is kept; the rest is skipped.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line) < MaxLineLength*utf8.UTFMax {
+			line = append(line, chunk...)
+		}
+		switch err {
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+		case nil:
+		default:
+			return "", err
+		}
+		return strings.TrimSuffix(string(line), "\n"), nil
+	}
+}
+
+// handleWriteFile processes a write_file tool call
+func handleWriteFile(tc *toolContext, input json.RawMessage) (string, bool) {
+	var params struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+		Append  bool   `json:"append"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return fmt.Sprintf("Error parsing tool input: %v", err), true
+	}
+
+	path, err := resolveToolPath(params.Path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+
+	before, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+
+	after := params.Content
+	action := "Write"
+	if params.Append {
+		after = string(before) + params.Content
+		action = "Append to"
+	}
+
+	return applyFileChange(tc, action, params.Path, path, string(before), after)
+}
+
+// handleEditFile processes an edit_file tool call
+func handleEditFile(tc *toolContext, input json.RawMessage) (string, bool) {
+	var params struct {
+		Path       string `json:"path"`
+		OldString  string `json:"old_string"`
+		NewString  string `json:"new_string"`
+		ReplaceAll bool   `json:"replace_all"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return fmt.Sprintf("Error parsing tool input: %v", err), true
+	}
+	if params.OldString == "" {
+		return "Error: old_string is required (use write_file to create a file)", true
+	}
+
+	path, err := resolveToolPath(params.Path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	before := string(data)
+
+	count := strings.Count(before, params.OldString)
+	switch {
+	case count == 0:
+		return fmt.Sprintf("Error: old_string not found in %s", params.Path), true
+	case count > 1 && !params.ReplaceAll:
+		return fmt.Sprintf("Error: old_string occurs %d times in %s; include more context or set replace_all", count, params.Path), true
+	}
+
+	after := strings.Replace(before, params.OldString, params.NewString, -1)
+	return applyFileChange(tc, "Edit", params.Path, path, before, after)
+}
+
+// applyFileChange shows the diff of a file change, asks for confirmation
+// unless auto-executing, and writes the file
+func applyFileChange(tc *toolContext, action, displayPath, path, before, after string) (string, bool) {
+	diff := unifiedDiff(displayPath, before, after)
+	if diff == "" {
+		return fmt.Sprintf("No changes to %s.", displayPath), false
+	}
+
+	printToolAction(action, displayPath)
+	renderMarkdown("```diff\n" + diff + "```")
+
+	if !tc.autoExecute {
+		approved, feedback, err := confirmAction("Apply this change?", ToolActionRisk)
+		if err != nil {
+			tc.stopErr = err
+			return fmt.Sprintf("Error: %v", err), true
+		}
+		if feedback != "" {
+			return fmt.Sprintf("The user did not apply this change and gave this feedback instead: %s", feedback), false
+		}
+		if !approved {
+			return "Change rejected by user.", false
+		}
+	}
+
+	perm := os.FileMode(CommandsPerms)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), DirPerms); err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	if err := os.WriteFile(path, []byte(after), perm); err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+
+	return fmt.Sprintf("Applied: %s %s.", strings.ToLower(action), displayPath), false
+}
+
+// handleListDir processes a list_dir tool call
+func handleListDir(tc *toolContext, input json.RawMessage) (string, bool) {
+	var params struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return fmt.Sprintf("Error parsing tool input: %v", err), true
+	}
+	if params.Path == "" {
+		params.Path = "."
+	}
+
+	path, err := resolveToolPath(params.Path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	printToolAction("Listing", params.Path)
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	if len(entries) == 0 {
+		return "(empty directory)", false
+	}
+
+	var out strings.Builder
+	for i, entry := range entries {
+		if i == MaxListEntries {
+			fmt.Fprintf(&out, "(%d more entries not shown)\n", len(entries)-i)
+			break
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		out.WriteString(name + "\n")
+	}
+	return out.String(), false
+}
+
+// handleGlob processes a glob tool call
+func handleGlob(tc *toolContext, input json.RawMessage) (string, bool) {
+	var params struct {
+		Pattern string `json:"pattern"`
+		Path    string `json:"path"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return fmt.Sprintf("Error parsing tool input: %v", err), true
+	}
+	if params.Path == "" {
+		params.Path = "."
+	}
+
+	root, err := resolveToolPath(params.Path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	re, err := globRegexp(params.Pattern)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid pattern: %v", err), true
+	}
+	printToolAction("Finding", params.Pattern)
+
+	var matches []string
+	err = walkFiles(root, func(path, rel string) bool {
+		if re.MatchString(rel) {
+			matches = append(matches, filepath.Join(params.Path, rel))
+		}
+		return len(matches) <= MaxListEntries
+	})
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	if len(matches) == 0 {
+		return "No files found.", false
+	}
+
+	sort.Strings(matches)
+	if len(matches) > MaxListEntries {
+		matches = append(matches[:MaxListEntries], "(more files not shown; use a narrower pattern)")
+	}
+	return strings.Join(matches, "\n"), false
+}
+
+// handleGrep processes a grep tool call
+func handleGrep(tc *toolContext, input json.RawMessage) (string, bool) {
+	var params struct {
+		Pattern    string `json:"pattern"`
+		Path       string `json:"path"`
+		Glob       string `json:"glob"`
+		IgnoreCase bool   `json:"ignore_case"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return fmt.Sprintf("Error parsing tool input: %v", err), true
+	}
+	if params.Path == "" {
+		params.Path = "."
+	}
+
+	pattern := params.Pattern
+	if params.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid pattern: %v", err), true
+	}
+
+	var fileFilter *regexp.Regexp
+	if params.Glob != "" {
+		if fileFilter, err = globRegexp(params.Glob); err != nil {
+			return fmt.Sprintf("Error: invalid glob: %v", err), true
+		}
+	}
+
+	root, err := resolveToolPath(params.Path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	printToolAction("Searching", fmt.Sprintf("%s in %s", params.Pattern, params.Path))
+
+	var out strings.Builder
+	count := 0
+	err = walkFiles(root, func(path, rel string) bool {
+		if fileFilter != nil && !fileFilter.MatchString(rel) {
+			return true
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > MaxGrepFile {
+			return true
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || isBinary(data) {
+			return true
+		}
+
+		display := filepath.Join(params.Path, rel)
+		for i, line := range splitLines(string(data)) {
+			if !re.MatchString(line) {
+				continue
+			}
+			count++
+			if count > MaxGrepMatches {
+				return false
+			}
+			fmt.Fprintf(&out, "%s:%d: %s\n", display, i+1, truncateLine(line))
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), true
+	}
+
+	if count == 0 {
+		return "No matches found.", false
+	}
+	if count > MaxGrepMatches {
+		fmt.Fprintf(&out, "(stopped after %d matches; use a narrower pattern or path)\n", MaxGrepMatches)
+	}
+	return out.String(), false
+}
+
+// handleAskUser processes an ask_user tool call
+func handleAskUser(tc *toolContext, input json.RawMessage) (string, bool) {
+	var params struct {
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal(input, &params); err != nil {
+		return fmt.Sprintf("Error parsing tool input: %v", err), true
+	}
+
+	// Command tests answer from their stdin; otherwise only a terminal can
+	if unattended || confirmPolicy == ConfirmNoInput || activeTest == nil && !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "Error: no user is available to answer questions; continue without an answer.", true
+	}
+
+	fmt.Printf("\n"+ansiBoldMagenta+"?"+ansiReset+" %s\n> ", params.Question)
+	answer, _ := stdinReader().ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "(The user gave no answer.)", false
+	}
+	return answer, false
+}
+
+// printToolAction shows the user what a file tool is doing
+func printToolAction(action, detail string) {
+	if quietMode {
+		return
+	}
+	fmt.Printf("\n"+ansiBoldBlue+"❯ %s:"+ansiReset+" %s\n", action, detail)
+}
+
+// resolveToolPath expands ~ in a path given by the model
+func resolveToolPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Clean(path), nil
+}
+
+// walkFiles calls fn for every regular file under root with its path relative
+// to root (using /). Hidden VCS directories are skipped. fn returns false to stop.
+func walkFiles(root string, fn func(path, rel string) bool) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		fn(root, filepath.Base(root))
+		return nil
+	}
+
+	stop := fmt.Errorf("stop")
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case ".git", ".hg", ".svn":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if !fn(path, filepath.ToSlash(rel)) {
+			return stop
+		}
+		return nil
+	})
+	if err == stop {
+		return nil
+	}
+	return err
+}
+
+// globRegexp converts a glob pattern to a regexp matching slash-separated paths.
+// * and ? don't cross directories; ** matches any number of directories.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = filepath.ToSlash(pattern)
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// isBinary reports whether data looks like a binary file
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// truncateLine shortens long lines in tool results to MaxLineLength characters
+func truncateLine(line string) string {
+	if utf8.RuneCountInString(line) <= MaxLineLength {
+		return line
+	}
+	return string([]rune(line)[:MaxLineLength]) + "..."
+}
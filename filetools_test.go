@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/x/main.go", true},
+		{"cmd/**", "cmd/x/main.go", true},
+		{"cmd/**", "docs/cmd.md", false},
+		{"docs/**/*.md", "docs/index.md", true},
+		{"docs/**/*.md", "docs/reference/testing.md", true},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+		{"?.txt", "/.txt", false},
+		{"a.b", "axb", false},
+		{"[x].go", "[x].go", true},
+		{"(x)+.go", "(x)+.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			re, err := globRegexp(tt.pattern)
+			if err != nil {
+				t.Fatalf("globRegexp(%q) error: %v", tt.pattern, err)
+			}
+			if got := re.MatchString(tt.path); got != tt.want {
+				t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "hello", "hello"},
+		{"at the limit", strings.Repeat("a", MaxLineLength), strings.Repeat("a", MaxLineLength)},
+		{"too long", strings.Repeat("a", MaxLineLength+1), strings.Repeat("a", MaxLineLength) + "..."},
+		{"multibyte", strings.Repeat("é", MaxLineLength+5), strings.Repeat("é", MaxLineLength) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateLine(tt.line); got != tt.want {
+				t.Errorf("truncateLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// RunFix handles: x fix [command...]
+// It finds the command that failed (the given one, or the last one run in the
+// shell), gets its output from stdin or by running it again, and passes
+// them to the fix pipeline, which suggests a corrected command.
+func RunFix(providers *Providers, config *CommandsConfig, cmd Command, args []string, opts RunOptions) error {
+	command, status := strings.Join(args, " "), ""
+	if command == "" {
+		command, status = lastShellCommand()
+	}
+	if command == "" {
+		return fmt.Errorf("no previous command found; run 'x fix <command>', or enable the hook with 'x %s'", CmdShellInit)
+	}
+
+	var output string
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		// Output piped in, e.g. make 2>&1 | x fix
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		output = string(data)
+		promptFromTerminal()
+	} else if status != "0" || len(args) > 0 {
+		var err error
+		if output, status, err = rerunFailedCommand(providers, command, opts); err != nil {
+			return err
+		}
+	}
+
+	if status == "0" {
+		fmt.Printf(ansiDim+"%s exited successfully; looking for problems anyway."+ansiReset+"\n", command)
+	}
+	if status == "" {
+		status = "unknown"
+	}
+	if output = tailLines(strings.TrimSpace(output), MaxFixOutputLines); output == "" {
+		output = "(not captured)"
+	}
+
+	return runCommand(providers, config, cmd, []string{command, status, output}, opts)
+}
+
+// rerunFailedCommand offers to run the failed command again to see its
+// output. It returns the output and exit status, or nothing if the user declines.
+func rerunFailedCommand(providers *Providers, command string, opts RunOptions) (string, string, error) {
+	if opts.PrintOnly || opts.DryRun {
+		return "", "", nil
+	}
+
+	review := newCommandReview(providers, command, "Run the command again to see why it fails", "", "")
+	if outcome, _ := review.Prompt(); outcome != reviewRun {
+		if review.Err != nil {
+			return "", "", review.Err
+		}
+		fmt.Println()
+		return "", "", nil
+	}
+
+	output, err := RunShellCommandStreaming(review.Command)
+	if errors.Is(err, ErrInterrupted) {
+		return "", "", err
+	}
+	return output, strconv.Itoa(exitCode(err)), nil
+}
+
+// lastShellCommand returns the last command run in the user's shell and its
+// exit status. The shell-init hook exports both; without it, the command is
+// read from the shell's history file and the status is unknown.
+func lastShellCommand() (string, string) {
+	if command := os.Getenv(EnvLastCommand); command != "" {
+		return command, os.Getenv(EnvLastStatus)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", ""
+	}
+
+	shell := filepath.Base(os.Getenv("SHELL"))
+	path := os.Getenv("HISTFILE")
+	switch shell {
+	case "zsh":
+		if path == "" {
+			path = filepath.Join(home, ".zsh_history")
+		}
+	case "fish":
+		path = filepath.Join(home, ".local", "share", "fish", "fish_history")
+	default:
+		if path == "" {
+			path = filepath.Join(home, ".bash_history")
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	// The last entry that isn't x fix itself
+	last := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		command := historyFileCommand(shell, scanner.Text())
+		if command != "" && !isFixInvocation(command) {
+			last = command
+		}
+	}
+	return last, ""
+}
+
+// historyFileCommand returns the command on a line of a shell history file,
+// or "" if the line doesn't hold one
+func historyFileCommand(shell, line string) string {
+	switch shell {
+	case "zsh":
+		// Extended history: ": 1700000000:0;command"
+		if strings.HasPrefix(line, ": ") {
+			if _, command, ok := strings.Cut(line, ";"); ok {
+				return strings.TrimSpace(command)
+			}
+		}
+	case "fish":
+		// "- cmd: command"
+		if command, ok := strings.CutPrefix(line, "- cmd: "); ok {
+			return strings.TrimSpace(command)
+		}
+		return ""
+	default:
+		// bash writes "#1700000000" timestamp lines when HISTTIMEFORMAT is set
+		if strings.HasPrefix(line, "#") {
+			return ""
+		}
+	}
+	return strings.TrimSpace(line)
+}
+
+// isFixInvocation reports whether a command runs x fix
+func isFixInvocation(command string) bool {
+	fields := strings.Fields(command)
+	return len(fields) >= 2 && filepath.Base(fields[0]) == "x" && fields[1] == FixCommand
+}
+
+// tailLines returns the last n lines of text
+func tailLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return fmt.Sprintf("... (%d earlier lines)\n", len(lines)-n) + strings.Join(lines[len(lines)-n:], "\n")
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// History entry statuses: what happened at the confirm prompt
+const (
+	HistoryApproved  = "approved"
+	HistoryCancelled = "cancelled" // The user declined it
+	HistoryRefused   = "refused"   // Declined without asking: by the confirm policy, or nobody could answer
+)
+
+// historyEntry is a command generated by the shell command for a query
+type historyEntry struct {
+	Query     string    `json:"query"`
+	Command   string    `json:"command"`
+	Summary   string    `json:"summary,omitempty"`
+	Risk      string    `json:"risk,omitempty"`
+	Safer     string    `json:"safer,omitempty"`
+	Status    string    `json:"status,omitempty"` // Empty in entries saved before statuses: approved
+	Directory string    `json:"directory"`
+	Time      time.Time `json:"time"`
+}
+
+// approved reports whether the command was approved to run
+func (e *historyEntry) approved() bool {
+	return e.Status == "" || e.Status == HistoryApproved
+}
+
+// getHistoryPath returns the shell history file path
+func getHistoryPath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, HistoryFileName), nil
+}
+
+// isShellCommand reports whether cmd is the built-in shell command, whose
+// generated commands are kept in the history
+func isShellCommand(cmd Command) bool {
+	return cmd.Name == ShellCommand && cmd.Source == BuiltinSource
+}
+
+// recordHistory appends a command reviewed at the shell command's confirm
+// prompt to the history, with its status. Failing to save it doesn't stop the command.
+func recordHistory(query string, review *commandReview, status string) {
+	if activeTest != nil || strings.TrimSpace(query) == "" {
+		return
+	}
+	directory, _ := os.Getwd()
+	entry := historyEntry{
+		Query:     query,
+		Command:   review.Command,
+		Summary:   review.Summary,
+		Risk:      review.Risk,
+		Safer:     review.Safer,
+		Status:    status,
+		Directory: directory,
+		Time:      time.Now(),
+	}
+	if err := appendHistory(entry); err != nil {
+		debugLog("Failed to save history: %v", err)
+	}
+}
+
+// appendHistory appends an entry to the history file
+func appendHistory(entry historyEntry) error {
+	path, err := getHistoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), DirPerms); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, ConfigFilePerms)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// LoadHistory reads the shell history, oldest first. Unreadable lines are skipped.
+func LoadHistory() ([]historyEntry, error) {
+	path, err := getHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// normalizeQuery makes queries that differ only in case and spacing equal
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// cachedCommand returns the most recent command approved for the same query
+// in the current directory, or nil
+func cachedCommand(query string) *historyEntry {
+	entries, err := LoadHistory()
+	if err != nil {
+		debugLog("Failed to load history: %v", err)
+		return nil
+	}
+
+	directory, _ := os.Getwd()
+	query = normalizeQuery(query)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].approved() && entries[i].Directory == directory && normalizeQuery(entries[i].Query) == query {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// offerCachedCommand offers the command generated the last time the same
+// query was asked in this directory, instead of asking the LLM again.
+// It returns false if there's none or the user wants a new one. It isn't
+// offered when the confirm policy decides without asking (--yes, --no-input).
+func offerCachedCommand(providers *Providers, query string, opts RunOptions) (bool, error) {
+	if unattended || activeTest != nil || opts.DryRun || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, nil
+	}
+	if confirmPolicy != ConfirmAlwaysAsk && confirmPolicy != ConfirmAskIfRisky {
+		return false, nil
+	}
+	entry := cachedCommand(query)
+	if entry == nil {
+		return false, nil
+	}
+
+	fmt.Printf(ansiDim+"You asked this here on %s:"+ansiReset+" %s\n", entry.Time.Format(DateTimeFormat), entry.Command)
+	fmt.Print("Use it again? [Y/n]: ")
+	response, _ := stdinReader().ReadString('\n')
+	switch strings.TrimSpace(strings.ToLower(response)) {
+	case "", "y", "yes":
+	default:
+		return false, nil
+	}
+
+	return true, runHistoryEntry(providers, entry, opts)
+}
+
+// runHistoryEntry runs a command from the history after the usual confirmation
+func runHistoryEntry(providers *Providers, entry *historyEntry, opts RunOptions) error {
+	if cwd, _ := os.Getwd(); entry.Directory != "" && cwd != entry.Directory {
+		fmt.Printf(ansiYellow+"⚠ This command was generated in %s"+ansiReset+"\n", entry.Directory)
+	}
+
+	review := newCommandReview(providers, entry.Command, entry.Summary, entry.Risk, entry.Safer)
+	if outcome, _ := review.Prompt(); outcome != reviewRun {
+		recordHistory(entry.Query, review, review.declinedStatus())
+		return review.cancelled()
+	}
+	recordHistory(entry.Query, review, HistoryApproved)
+	if opts.DryRun {
+		fmt.Printf("[DRYRUN] Would execute: %s\n", review.Command)
+		return nil
+	}
+
+	activeRun.startStep(ShellCommand+".history", "exec")
+	err := RunShellCommand(review.Command)
+	activeRun.recordExec(review.Command, true, err)
+	activeRun.endStep(err)
+	return err
+}
+
+// RunHistory handles: x history [-n limit] [search...]
+// Matching commands are listed, most relevant first, and one can be picked to run again.
+func RunHistory(providers *Providers, opts RunOptions, args []string) error {
+	limit := DefaultHistoryLimit
+	var terms []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-n" || args[i] == "--limit" {
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s needs a value", args[i])
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s", args[i], args[i+1])
+			}
+			limit = n
+			i++
+			continue
+		}
+		terms = append(terms, args[i])
+	}
+
+	entries, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+	matches := searchHistory(entries, strings.Join(terms, " "))
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	if len(matches) == 0 {
+		fmt.Println("No matching commands.")
+		return nil
+	}
+
+	cwd, _ := os.Getwd()
+	for i, entry := range matches {
+		status := ""
+		if !entry.approved() {
+			status = " (" + entry.Status + ")"
+		}
+		fmt.Printf(ansiBold+"%2d"+ansiReset+"  %s  "+ansiDim+"%s%s"+ansiReset+"\n", i+1, entry.Command, entry.Query, status)
+		if entry.Directory != cwd {
+			fmt.Printf("    "+ansiDim+"%s · %s"+ansiReset+"\n", entry.Time.Format(DateTimeFormat), entry.Directory)
+		}
+	}
+
+	// Only offer to run one when someone can pick
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+
+	fmt.Printf("\nRun which? [1-%d, Enter to cancel]: ", len(matches))
+	response, _ := stdinReader().ReadString('\n')
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(response)
+	if err != nil || n < 1 || n > len(matches) {
+		return fmt.Errorf("invalid choice: %s", response)
+	}
+
+	// Record the rerun in the run history like any other command
+	run := beginRun(Command{Name: CmdHistory}, args, opts)
+	err = runHistoryEntry(providers, &matches[n-1], opts)
+	run.end(err)
+	return err
+}
+
+// searchHistory returns the entries matching a fuzzy search, most relevant
+// first and most recent first among equals. Repeated commands are listed once.
+func searchHistory(entries []historyEntry, search string) []historyEntry {
+	type match struct {
+		entry historyEntry
+		score int
+	}
+
+	terms := strings.Fields(strings.ToLower(search))
+	seen := make(map[string]bool)
+	var matches []match
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if seen[entry.Command] {
+			continue
+		}
+		score, ok := fuzzyScore(terms, strings.ToLower(entry.Query+" "+entry.Command))
+		if !ok {
+			continue
+		}
+		seen[entry.Command] = true
+		matches = append(matches, match{entry, score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	result := make([]historyEntry, len(matches))
+	for i, m := range matches {
+		result[i] = m.entry
+	}
+	return result
+}
+
+// fuzzyScore scores how well text matches the search terms. Every term must
+// appear in text, as a substring (scored higher) or as a subsequence of its letters.
+func fuzzyScore(terms []string, text string) (int, bool) {
+	score := 0
+	for _, t := range terms {
+		switch idx := strings.Index(text, t); {
+		case idx == 0 || idx > 0 && !isWordChar(text[idx-1]):
+			score += 3
+		case idx > 0:
+			score += 2
+		case isSubsequence(t, text):
+			score++
+		default:
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// isSubsequence reports whether the letters of s appear in order in text
+func isSubsequence(s, text string) bool {
+	i := 0
+	for j := 0; j < len(text) && i < len(s); j++ {
+		if text[j] == s[i] {
+			i++
+		}
+	}
+	return i == len(s)
+}
+
+// isWordChar reports whether c is a letter or digit
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		terms     []string
+		text      string
+		wantScore int
+		wantOK    bool
+	}{
+		{"word start", []string{"list"}, "list files", 3, true},
+		{"after a separator", []string{"files"}, "list files", 3, true},
+		{"inside a word", []string{"iles"}, "list files", 2, true},
+		{"subsequence", []string{"lfs"}, "list files", 1, true},
+		{"every term scored", []string{"list", "iles", "lfs"}, "list files", 6, true},
+		{"missing term", []string{"list", "docker"}, "list files", 0, false},
+		{"letters out of order", []string{"sl"}, "list", 0, false},
+		{"no terms", nil, "list files", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok := fuzzyScore(tt.terms, tt.text)
+			if score != tt.wantScore || ok != tt.wantOK {
+				t.Errorf("fuzzyScore(%q, %q) = %d, %v, want %d, %v", tt.terms, tt.text, score, ok, tt.wantScore, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHistoryEntryApproved(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{"", true},
+		{HistoryApproved, true},
+		{HistoryCancelled, false},
+		{HistoryRefused, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			e := &historyEntry{Status: tt.status}
+			if got := e.approved(); got != tt.want {
+				t.Errorf("approved() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,20 +2,35 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
+	"syscall"
 )
 
 func main() {
+	// Global flags come before the command, so they don't clash with its args
+	args, opts, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		exitWithError(err)
+	}
+	if err := opts.apply(); err != nil {
+		exitWithError(&ConfigError{Err: err})
+	}
+	os.Args = append(os.Args[:1], args...)
+
 	// Handle --help and -h flags
 	if len(os.Args) >= 2 && (os.Args[1] == "--help" || os.Args[1] == "-h") {
 		config, _ := LoadCommandsConfig()
 		if config == nil {
 			config = &CommandsConfig{
-				Default:  "shell",
+				Default:  ShellCommand,
 				Commands: make(map[string]Command),
 			}
 		}
+		warnShadowedCommands(config)
 		PrintHelp(config)
 		return
 	}
@@ -24,16 +39,66 @@ func main() {
 	if len(os.Args) >= 2 {
 		switch os.Args[1] {
 		case CmdConfigure:
-			if err := RunConfigure(); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
+			if err := RunConfigure(os.Args[2:]); err != nil {
+				exitWithError(err)
 			}
 			return
 
 		case CmdCommands:
+			if len(os.Args) >= 3 && os.Args[2] == "test" {
+				if err := RunCommandTests(os.Args[3:]); err != nil {
+					exitWithError(err)
+				}
+				return
+			}
 			if err := RunCommandsEditor(); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
+				exitWithError(err)
+			}
+			return
+
+		case CmdMCP:
+			if err := RunMCP(opts, os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+
+		case CmdRuns:
+			if err := RunRuns(loadProviders(opts), opts, os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+
+		case CmdExplain:
+			if err := RunExplain(loadProviders(opts), opts, os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+
+		case CmdHistory:
+			if err := RunHistory(loadProviders(opts), opts, os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+
+		case CmdShellInit:
+			if err := RunShellInit(os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+
+		case CmdCompletion:
+			if err := RunCompletion(os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+
+		case CmdComplete:
+			RunComplete(os.Args[2:])
+			return
+
+		case CmdServe:
+			if err := RunServe(opts, os.Args[2:]); err != nil {
+				exitWithError(err)
 			}
 			return
 
@@ -48,23 +113,28 @@ func main() {
 
 		case CmdUpgrade:
 			if err := RunUpgrade(); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 			return
 
 		case CmdVersion:
 			fmt.Printf("x version %s\n", Version)
 			return
+
+		case CmdChat:
+			if err := RunChat(loadProviders(opts), os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
 		}
 	}
 
 	// Load commands configuration
 	commandsConfig, err := LoadCommandsConfig()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading commands: %v\n", err)
-		os.Exit(1)
+		exitWithError(&ConfigError{Err: fmt.Errorf("loading commands: %w", err)})
 	}
+	warnShadowedCommands(commandsConfig)
 
 	// No args provided - show help or use default
 	if len(os.Args) < 2 {
@@ -72,42 +142,47 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Check if first arg is --help for a command (e.g., "x cmd --help")
+	// Check if the first args name a known command, following groups (e.g., "x db migrate")
 	firstArg := os.Args[1]
-
-	// Check if first arg is a known command
-	cmd, isCommand := commandsConfig.Commands[firstArg]
+	name, cmdArgs := commandsConfig.FindCommand(os.Args[1:])
+	cmd, isCommand := commandsConfig.Commands[name]
 
 	if isCommand {
 		// Check for command-specific help
-		if len(os.Args) >= 3 && (os.Args[2] == "--help" || os.Args[2] == "-h") {
-			PrintCommandHelp(firstArg, cmd)
+		if len(cmdArgs) >= 1 && (cmdArgs[0] == "--help" || cmdArgs[0] == "-h") {
+			PrintCommandHelp(name, cmd)
+			return
+		}
+	} else if commandsConfig.IsGroup(name) {
+		// A group on its own lists its commands. Other words after a group
+		// go to the default command like any unknown command.
+		switch {
+		case len(cmdArgs) == 0:
+			PrintGroupHelp(commandsConfig, name)
+			os.Exit(1)
+		case cmdArgs[0] == "--help" || cmdArgs[0] == "-h":
+			PrintGroupHelp(commandsConfig, name)
 			return
 		}
 	}
 
-	// Load configuration for API access
-	config, err := LoadConfig()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Run 'x configure' to set up authentication.\n")
-		os.Exit(1)
-	}
+	// Load LLM provider configuration (providers are created on first use,
+	// so commands without LLM steps work before 'x configure')
+	providers := loadProviders(opts)
 
-	// Create API client
-	ctx := context.Background()
-	client, err := CreateClient(ctx, config)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating client: %v\n", err)
-		os.Exit(1)
+	// The built-in fix command finds the failed command before running its pipeline
+	if isCommand && name == FixCommand && cmd.Source == BuiltinSource {
+		if err := RunFix(providers, commandsConfig, cmd, cmdArgs, opts); err != nil {
+			exitWithError(err)
+		}
+		return
 	}
 
 	// Route to appropriate handler
 	if isCommand {
 		// Run the matched command with remaining args
-		if _, err := RunPipeline(client, config.AuthType, commandsConfig, cmd, os.Args[2:], false); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := runCommand(providers, commandsConfig, cmd, cmdArgs, opts); err != nil {
+			exitWithError(err)
 		}
 		return
 	}
@@ -116,9 +191,8 @@ func main() {
 	defaultCmd, hasDefault := commandsConfig.Commands[commandsConfig.Default]
 	if hasDefault {
 		// Use all args as input to the default command
-		if _, err := RunPipeline(client, config.AuthType, commandsConfig, defaultCmd, os.Args[1:], false); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if err := runCommand(providers, commandsConfig, defaultCmd, os.Args[1:], opts); err != nil {
+			exitWithError(err)
 		}
 		return
 	}
@@ -128,3 +202,70 @@ func main() {
 	fmt.Fprintf(os.Stderr, "Run 'x --help' to see available commands.\n")
 	os.Exit(1)
 }
+
+// exitWithError reports an error and exits with its exit code.
+// Printing a command instead of running it is not an error, and a declined
+// or refused confirmation isn't reported.
+func exitWithError(err error) {
+	code := exitCodeFor(err)
+	if code != 0 && !errors.Is(err, ErrCancelled) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(code)
+}
+
+// exitCodeFor returns the exit code for an error. A failed shell command
+// exits with its own code, so x can stand in for the command in scripts.
+func exitCodeFor(err error) int {
+	var exitErr exitCoder
+	var llmErr *LLMError
+	var configErr *ConfigError
+	var netErr net.Error
+	switch {
+	case err == nil, errors.Is(err, ErrCommandPrinted):
+		return 0
+	case errors.Is(err, ErrInterrupted), interruptedBySignal(err):
+		return ExitCodeInterrupted
+	case errors.Is(err, ErrCancelled), errors.Is(err, ErrNoInput):
+		return ExitCodeCancelled
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0:
+		return exitErr.ExitCode()
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ExitCodeTimeout
+	case errors.As(err, &llmErr) && llmErr.isAuth():
+		return ExitCodeAuth
+	case errors.As(err, &llmErr):
+		return ExitCodeLLM
+	case errors.As(err, &configErr), errors.Is(err, ErrNotConfigured), errors.Is(err, ErrUnknownProvider),
+		errors.Is(err, ErrInvalidAuthType), errors.Is(err, ErrMissingAPIKey), errors.Is(err, ErrMissingProjectID),
+		errors.Is(err, ErrMissingRegion):
+		return ExitCodeConfig
+	default:
+		return ExitCodeError
+	}
+}
+
+// interruptedBySignal reports whether err is a command killed by SIGINT,
+// e.g. by Ctrl+C while it ran in the terminal
+func interruptedBySignal(err error) bool {
+	var execErr *exec.ExitError
+	if !errors.As(err, &execErr) {
+		return false
+	}
+	status, ok := execErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGINT
+}
+
+// loadProviders loads the configuration into a provider registry, with the
+// model from the options. A missing configuration is reported when an LLM
+// step first needs a provider.
+func loadProviders(opts RunOptions) *Providers {
+	config, err := LoadConfig()
+	if err != nil {
+		debugLog("Failed to load config: %v", err)
+		config = nil
+	}
+	providers := NewProviders(config, err)
+	providers.model = opts.Model
+	return providers
+}
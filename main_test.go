@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	if _, ok := exitErr.(*exec.ExitError); !ok {
+		t.Fatalf("sh -c 'exit 3' = %v, want an *exec.ExitError", exitErr)
+	}
+
+	interruptErr := exec.Command("sh", "-c", "kill -INT $$").Run()
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"command printed", ErrCommandPrinted, 0},
+		{"other error", errors.New("missing argument"), ExitCodeError},
+		{"interrupted", fmt.Errorf("step: %w", ErrInterrupted), ExitCodeInterrupted},
+		{"command killed by SIGINT", &StepError{Step: 1, Err: interruptErr}, ExitCodeInterrupted},
+		{"cancelled", ErrCancelled, ExitCodeCancelled},
+		{"no input", &StepError{Step: 1, Err: ErrNoInput}, ExitCodeCancelled},
+		{"failed command", &StepError{Step: 2, Err: exitErr}, 3},
+		{"mocked command", &StepError{Step: 1, Err: &ExitStatusError{Code: 42}}, 42},
+		{"command exiting like a config error", &ExitStatusError{Code: ExitCodeConfig}, ExitCodeConfig},
+		{"deadline", fmt.Errorf("llm: %w", context.DeadlineExceeded), ExitCodeTimeout},
+		{"network timeout", &LLMError{Provider: "openai", Err: &net.DNSError{IsTimeout: true}}, ExitCodeTimeout},
+		{"unauthorized", &LLMError{Provider: "openai", StatusCode: 401, Err: errors.New("bad key")}, ExitCodeAuth},
+		{"forbidden", &LLMError{Provider: "openai", StatusCode: 403, Err: errors.New("no access")}, ExitCodeAuth},
+		{"provider error", &LLMError{Provider: "openai", StatusCode: 500, Err: errors.New("overloaded")}, ExitCodeLLM},
+		{"unreachable provider", &LLMError{Provider: "ollama", Err: errors.New("connection refused")}, ExitCodeLLM},
+		{"config error", &ConfigError{Err: errors.New("bad yaml")}, ExitCodeConfig},
+		{"not configured", fmt.Errorf("step 1: %w", ErrNotConfigured), ExitCodeConfig},
+		{"missing API key", ErrMissingAPIKey, ExitCodeConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeFor(tt.err); got != tt.want {
+				t.Errorf("exitCodeFor(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MCP protocol settings
+const (
+	MCPProtocolVersion = "2025-06-18"
+	mcpStartTimeout    = 30 * time.Second // For initialize and tools/list
+	mcpCallTimeout     = 5 * time.Minute  // For a tools/call
+	mcpCloseTimeout    = 2 * time.Second  // Grace period before killing a server
+)
+
+// MCPServer is a Model Context Protocol server launched over stdio
+type MCPServer struct {
+	Name    string            `yaml:"name" json:"name"`
+	Command string            `yaml:"command" json:"command"`   // Shell command that starts the server
+	Env     map[string]string `yaml:"env" json:"env,omitempty"` // Extra environment variables
+}
+
+// UnmarshalYAML accepts a server definition, or just the name of a server
+// declared under the top-level mcp: key
+func (s *MCPServer) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		s.Name = value.Value
+		return nil
+	}
+
+	type plain MCPServer
+	return value.Decode((*plain)(s))
+}
+
+// resolveMCPServers fills in servers referenced by name from the global declarations
+func resolveMCPServers(servers []MCPServer, config *CommandsConfig) ([]MCPServer, error) {
+	var resolved []MCPServer
+	for _, server := range servers {
+		if server.Command == "" {
+			global, ok := config.MCP[server.Name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownMCPServer, server.Name)
+			}
+			server = global
+		}
+		if server.Name == "" {
+			return nil, fmt.Errorf("MCP server %q has no name", server.Command)
+		}
+		resolved = append(resolved, server)
+	}
+	return resolved, nil
+}
+
+// JSON-RPC 2.0 messages, shared by the MCP client and server
+
+// rpcMessage is a JSON-RPC request, notification or response
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// mcpTool is a tool listed by an MCP server
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// mcpContent is an item of a tools/call result
+type mcpContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Resource *struct {
+		URI  string `json:"uri"`
+		Text string `json:"text,omitempty"`
+	} `json:"resource,omitempty"`
+}
+
+// mcpCallResult is the result of tools/call
+type mcpCallResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// mcpClient talks to an MCP server process over its stdin and stdout
+type mcpClient struct {
+	name        string
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	callTimeout time.Duration // How long a tool call can take
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *rpcMessage
+	done    chan struct{} // Closed when the server's stdout closes
+}
+
+// startMCPClient launches a server and performs the initialize handshake
+func startMCPClient(server MCPServer) (*mcpClient, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == OSWindows {
+		cmd = exec.Command("cmd", "/C", server.Command)
+	} else {
+		cmd = exec.Command("bash", "-c", server.Command)
+	}
+
+	cmd.Env = os.Environ()
+	for key, value := range server.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	if isDebug() {
+		cmd.Stderr = os.Stderr
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", server.Name, err)
+	}
+
+	c := &mcpClient{
+		name:        server.Name,
+		cmd:         cmd,
+		stdin:       stdin,
+		callTimeout: mcpCallTimeout,
+		pending:     make(map[string]chan *rpcMessage),
+		done:        make(chan struct{}),
+	}
+	go c.readLoop(stdout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpStartTimeout)
+	defer cancel()
+
+	params := map[string]any{
+		"protocolVersion": MCPProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "x", "version": Version},
+	}
+	if err := c.request(ctx, "initialize", params, nil); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("MCP server %s: initialize failed: %w", server.Name, err)
+	}
+	if err := c.send(rpcMessage{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("MCP server %s: %w", server.Name, err)
+	}
+
+	debugLog("MCP server %s started", server.Name)
+	return c, nil
+}
+
+// send writes a message as a line of JSON
+func (c *mcpClient) send(msg rpcMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// request sends a request and waits for its response, decoding the result into result (if non-nil)
+func (c *mcpClient) request(ctx context.Context, method string, params any, result any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.nextID++
+	id := fmt.Sprint(c.nextID)
+	ch := make(chan *rpcMessage, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: data}); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-c.done:
+		return fmt.Errorf("server exited")
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out waiting for %s", method)
+		}
+		return ErrInterrupted
+	}
+}
+
+// readLoop dispatches responses from the server until its stdout closes
+func (c *mcpClient) readLoop(stdout io.Reader) {
+	defer close(c.done)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			debugLog("MCP %s: ignoring invalid message: %v", c.name, err)
+			continue
+		}
+
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			// A request from the server; only ping is supported
+			reply := rpcMessage{JSONRPC: "2.0", ID: msg.ID}
+			if msg.Method == "ping" {
+				reply.Result = json.RawMessage("{}")
+			} else {
+				reply.Error = &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + msg.Method}
+			}
+			c.send(reply)
+
+		case msg.Method != "":
+			// Notifications (logging, progress, list changes) are ignored
+
+		default:
+			c.mu.Lock()
+			ch, ok := c.pending[strings.Trim(string(msg.ID), `"`)]
+			c.mu.Unlock()
+			if ok {
+				ch <- &msg
+			}
+		}
+	}
+}
+
+// listTools returns all tools offered by the server
+func (c *mcpClient) listTools() ([]mcpTool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mcpStartTimeout)
+	defer cancel()
+
+	var tools []mcpTool
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var result struct {
+			Tools      []mcpTool `json:"tools"`
+			NextCursor string    `json:"nextCursor"`
+		}
+		if err := c.request(ctx, "tools/list", params, &result); err != nil {
+			return nil, fmt.Errorf("MCP server %s: tools/list failed: %w", c.name, err)
+		}
+
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// callTool calls a tool and returns its result as text. It gives up after
+// the client's call timeout, or when the user presses Ctrl+C.
+func (c *mcpClient) callTool(name string, arguments json.RawMessage) (string, bool, error) {
+	if len(arguments) == 0 || string(arguments) == "null" {
+		arguments = json.RawMessage("{}")
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	var result mcpCallResult
+	err := c.request(ctx, "tools/call", map[string]any{"name": name, "arguments": arguments}, &result)
+	if err != nil {
+		return "", true, err
+	}
+
+	var parts []string
+	for _, item := range result.Content {
+		switch {
+		case item.Type == "text":
+			parts = append(parts, item.Text)
+		case item.Resource != nil && item.Resource.Text != "":
+			parts = append(parts, item.Resource.Text)
+		case item.Resource != nil:
+			parts = append(parts, fmt.Sprintf("[resource: %s]", item.Resource.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content omitted]", item.Type))
+		}
+	}
+
+	return strings.Join(parts, "\n"), result.IsError, nil
+}
+
+// Close stops the server, killing it if it doesn't exit promptly
+func (c *mcpClient) Close() {
+	c.stdin.Close()
+
+	exited := make(chan struct{})
+	go func() {
+		c.cmd.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+	case <-time.After(mcpCloseTimeout):
+		c.cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// startMCPTools starts the servers and adds their tools, named
+// <server>_<tool>, to tools. It returns a function that stops the servers.
+func startMCPTools(servers []MCPServer, tools []agentTool) ([]agentTool, func(), error) {
+	var clients []*mcpClient
+	closeAll := func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}
+
+	for _, server := range servers {
+		client, err := startMCPClient(server)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		clients = append(clients, client)
+
+		listed, err := client.listTools()
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		for _, tool := range listed {
+			wrapped := mcpAgentTool(client, tool)
+			if slices.Contains(toolNames(tools), wrapped.Def.Name) {
+				closeAll()
+				return nil, nil, fmt.Errorf("MCP server %s: tool %s conflicts with another tool", server.Name, wrapped.Def.Name)
+			}
+			tools = append(tools, wrapped)
+		}
+		debugLog("MCP server %s offers %d tools", server.Name, len(listed))
+	}
+
+	return tools, closeAll, nil
+}
+
+// mcpAgentTool wraps an MCP tool as an agent tool. Calls need confirmation
+// unless the step auto-executes.
+func mcpAgentTool(client *mcpClient, tool mcpTool) agentTool {
+	def := ToolDef{
+		Name:        invalidToolNameChars.ReplaceAllString(client.name+"_"+tool.Name, "_"),
+		Description: tool.Description,
+	}
+	if properties, ok := tool.InputSchema["properties"].(map[string]any); ok {
+		def.Properties = properties
+	}
+	if required, ok := tool.InputSchema["required"].([]any); ok {
+		for _, name := range required {
+			if s, ok := name.(string); ok {
+				def.Required = append(def.Required, s)
+			}
+		}
+	}
+
+	// A server's readOnlyHint is only a hint, so every call is confirmed
+	handle := func(tc *toolContext, input json.RawMessage) (string, bool) {
+		printToolAction("MCP", client.name+" "+tool.Name)
+
+		if !tc.autoExecute {
+			if args := formatToolInput(input); args != "" {
+				renderMarkdown("```json\n" + args + "\n```")
+			}
+			approved, feedback, err := confirmAction("Allow this tool call?", ToolActionRisk)
+			if err != nil {
+				tc.stopErr = err
+				return fmt.Sprintf("Error: %v", err), true
+			}
+			if feedback != "" {
+				return fmt.Sprintf("The user did not allow this tool call and gave this feedback instead: %s", feedback), false
+			}
+			if !approved {
+				return "Tool call rejected by user.", false
+			}
+		}
+
+		result, isError, err := client.callTool(tool.Name, input)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), true
+		}
+		return result, isError
+	}
+
+	return agentTool{Def: def, Handle: handle}
+}
+
+// formatToolInput pretty-prints tool arguments, or returns "" if there are none
+func formatToolInput(input json.RawMessage) string {
+	var args map[string]any
+	if err := json.Unmarshal(input, &args); err != nil || len(args) == 0 {
+		return ""
+	}
+	data, err := json.MarshalIndent(args, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// mcpServerNames returns the sorted names of servers
+func mcpServerNames(servers []MCPServer) []string {
+	names := make([]string, 0, len(servers))
+	for _, server := range servers {
+		names = append(names, server.Name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envMCPStub makes the test binary run as a stub MCP server
+const envMCPStub = "X_TEST_MCP_STUB"
+
+// TestMCPStubServer is the stub MCP server run by TestMCPClient. It offers
+// echo, fail and hang over two pages of tools/list.
+func TestMCPStubServer(t *testing.T) {
+	if os.Getenv(envMCPStub) == "" {
+		t.Skip("only runs as a stub MCP server")
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	reply := func(msg rpcMessage, result any) {
+		data, _ := json.Marshal(result)
+		out.Encode(rpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: data})
+	}
+	tool := func(name string) map[string]any {
+		return map[string]any{"name": name, "inputSchema": map[string]any{"type": "object"}}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil || len(msg.ID) == 0 {
+			continue
+		}
+		switch msg.Method {
+		case "initialize":
+			reply(msg, map[string]any{"protocolVersion": MCPProtocolVersion, "capabilities": map[string]any{"tools": map[string]any{}}})
+		case "tools/list":
+			if strings.Contains(string(msg.Params), "page-2") {
+				reply(msg, map[string]any{"tools": []any{tool("hang")}})
+			} else {
+				reply(msg, map[string]any{"tools": []any{tool("echo"), tool("fail")}, "nextCursor": "page-2"})
+			}
+		case "tools/call":
+			var params struct {
+				Name      string `json:"name"`
+				Arguments struct {
+					Text string `json:"text"`
+				} `json:"arguments"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			switch params.Name {
+			case "echo":
+				reply(msg, mcpCallResult{Content: []mcpContent{{Type: "text", Text: params.Arguments.Text}, {Type: "image"}}})
+			case "fail":
+				reply(msg, mcpCallResult{Content: []mcpContent{{Type: "text", Text: "it failed"}}, IsError: true})
+			case "hang":
+			default:
+				out.Encode(rpcMessage{JSONRPC: "2.0", ID: msg.ID, Error: &rpcError{Code: rpcInvalidParams, Message: "unknown tool"}})
+			}
+		}
+	}
+	os.Exit(0)
+}
+
+func TestMCPClient(t *testing.T) {
+	client, err := startMCPClient(MCPServer{
+		Name:    "stub",
+		Command: "'" + os.Args[0] + "' -test.run='^TestMCPStubServer$'",
+		Env:     map[string]string{envMCPStub: "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.callTimeout = 500 * time.Millisecond
+
+	tools, err := client.listTools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	if want := []string{"echo", "fail", "hang"}; !slices.Equal(names, want) {
+		t.Errorf("tools/list = %v, want %v", names, want)
+	}
+
+	tests := []struct {
+		tool        string
+		args        string
+		want        string
+		wantIsError bool
+		wantErr     string
+	}{
+		{tool: "echo", args: `{"text":"hello"}`, want: "hello\n[image content omitted]"},
+		{tool: "echo", want: "\n[image content omitted]"},
+		{tool: "fail", want: "it failed", wantIsError: true},
+		{tool: "missing", wantErr: "unknown tool"},
+		{tool: "hang", wantErr: "timed out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			result, isError, err := client.callTool(tt.tool, json.RawMessage(tt.args))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("callTool() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.want || isError != tt.wantIsError {
+				t.Errorf("callTool() = %q, %v, want %q, %v", result, isError, tt.want, tt.wantIsError)
+			}
+		})
+	}
+}
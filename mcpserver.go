@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// mcpProtocolVersions are the protocol versions x mcp serve can speak, newest first
+var mcpProtocolVersions = []string{MCPProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// mcpServer serves commands as MCP tools over stdio
+type mcpServer struct {
+	providers    *Providers
+	config       *CommandsConfig
+	allowConfirm bool              // Expose commands with confirm steps, approving their prompts
+	options      RunOptions        // Options commands run with
+	commands     map[string]string // Tool name -> command name
+
+	out io.Writer
+}
+
+// RunMCP handles the mcp built-in command
+func RunMCP(opts RunOptions, args []string) error {
+	if len(args) == 0 || args[0] != "serve" {
+		return fmt.Errorf("usage: x mcp serve [--allow-confirm]")
+	}
+
+	server := &mcpServer{options: opts}
+	for _, arg := range args[1:] {
+		switch arg {
+		case "--allow-confirm":
+			server.allowConfirm = true
+		default:
+			return fmt.Errorf("unknown flag: %s", arg)
+		}
+	}
+
+	config, err := LoadCommandsConfig()
+	if err != nil {
+		return err
+	}
+	server.config = config
+	server.providers = loadProviders(opts)
+
+	// stdin and stdout carry the protocol. Anything the pipelines print goes
+	// to stderr, and no prompt can read from stdin.
+	in, out := os.Stdin, os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	os.Stdin, os.Stdout = devNull, os.Stderr
+	defer func() { os.Stdin, os.Stdout = in, out }()
+
+	unattended = true
+	unattendedApprove = server.allowConfirm
+
+	server.out = out
+	return server.serve(in)
+}
+
+// serve handles requests one at a time until stdin closes
+func (s *mcpServer) serve(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			s.reply(json.RawMessage("null"), nil, &rpcError{Code: rpcParseError, Message: err.Error()})
+			continue
+		}
+		if len(msg.ID) == 0 {
+			// Notifications need no reply
+			continue
+		}
+		if msg.Method == "" {
+			// A response to a request we never send
+			continue
+		}
+
+		result, rpcErr := s.handle(msg.Method, msg.Params)
+		s.reply(msg.ID, result, rpcErr)
+	}
+	return scanner.Err()
+}
+
+// reply writes a response
+func (s *mcpServer) reply(id json.RawMessage, result any, rpcErr *rpcError) {
+	msg := rpcMessage{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			msg.Error = &rpcError{Code: rpcInternalError, Message: err.Error()}
+		} else {
+			msg.Result = data
+		}
+	}
+
+	data, _ := json.Marshal(msg)
+	fmt.Fprintf(s.out, "%s\n", data)
+}
+
+// handle dispatches a request by method
+func (s *mcpServer) handle(method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(params, &p)
+
+		version := MCPProtocolVersion
+		if slices.Contains(mcpProtocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "x", "version": Version},
+		}, nil
+
+	case "ping":
+		return map[string]any{}, nil
+
+	case "tools/list":
+		return map[string]any{"tools": s.listTools()}, nil
+
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		return s.callTool(p.Name, p.Arguments)
+
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+// listTools describes the commands that can be called, sorted by name
+func (s *mcpServer) listTools() []map[string]any {
+	names := make([]string, 0, len(s.config.Commands))
+	for name := range s.config.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s.commands = make(map[string]string)
+	var tools []map[string]any
+	for _, name := range names {
+		cmd := s.config.Commands[name]
+		confirm := needsConfirm(s.config, cmd, nil)
+		if confirm && !s.allowConfirm {
+			debugLog("MCP: not exposing %s (asks for confirmation)", name)
+			continue
+		}
+
+		def := commandToolDef(name, cmd)
+		if _, taken := s.commands[def.Name]; taken {
+			debugLog("MCP: not exposing %s (tool name %s is taken)", name, def.Name)
+			continue
+		}
+		s.commands[def.Name] = name
+
+		schema := map[string]any{
+			"type":       "object",
+			"properties": def.Properties,
+		}
+		if len(def.Required) > 0 {
+			schema["required"] = def.Required
+		}
+
+		tool := map[string]any{
+			"name":        def.Name,
+			"description": def.Description,
+			"inputSchema": schema,
+		}
+		if confirm {
+			tool["description"] = def.Description + " (Normally asks for confirmation; calling this tool approves it.)"
+			tool["annotations"] = map[string]any{"destructiveHint": true}
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// callTool runs a command and returns its output as the tool result.
+// Failures are reported as tool errors rather than protocol errors.
+func (s *mcpServer) callTool(toolName string, arguments json.RawMessage) (any, *rpcError) {
+	if s.commands == nil {
+		s.listTools()
+	}
+	name, ok := s.commands[toolName]
+	if !ok {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("%v: %s", ErrUnknownTool, toolName)}
+	}
+	cmd := s.config.Commands[name]
+
+	if len(arguments) == 0 || string(arguments) == "null" {
+		arguments = json.RawMessage("{}")
+	}
+	args, err := commandToolArgs(cmd, arguments)
+	if err != nil {
+		return mcpToolResult(err.Error(), true), nil
+	}
+
+	debugLog("MCP: running %s %v", name, args)
+	output, err := RunPipeline(s.providers, s.config, cmd, args, s.options, true)
+	if errors.Is(err, ErrCancelled) {
+		return mcpToolResult("Cancelled: the command needs confirmation, which isn't available over MCP.", true), nil
+	}
+	if err != nil {
+		return mcpToolResult(fmt.Sprintf("Error: %v", err), true), nil
+	}
+	if strings.TrimSpace(output) == "" {
+		output = "(no output)"
+	}
+	return mcpToolResult(output, false), nil
+}
+
+// mcpToolResult builds a tools/call result with a single text item
+func mcpToolResult(text string, isError bool) mcpCallResult {
+	return mcpCallResult{
+		Content: []mcpContent{{Type: "text", Text: text}},
+		IsError: isError,
+	}
+}
+
+// needsConfirm reports whether running a command asks for confirmation at
+// an exec step or in an agentic step, including in the commands it calls as
+// subcommands or tools
+func needsConfirm(config *CommandsConfig, cmd Command, seen map[string]bool) bool {
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+	if seen[cmd.Name] {
+		return false
+	}
+	seen[cmd.Name] = true
+
+	for _, step := range cmd.Steps {
+		if step.Exec != nil && step.Exec.Confirm {
+			return true
+		}
+		if step.Agentic != nil && agenticNeedsConfirm(config, step.Agentic, seen) {
+			return true
+		}
+		if step.Subcommand != nil {
+			if sub, ok := config.Commands[step.Subcommand.Name]; ok && needsConfirm(config, sub, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// agenticNeedsConfirm reports whether an agentic step asks for confirmation:
+// without auto_execute, shell commands, file changes and MCP tool calls do
+func agenticNeedsConfirm(config *CommandsConfig, step *AgenticStep, seen map[string]bool) bool {
+	if step.AutoExecute {
+		return false
+	}
+	if len(step.Tools) == 0 || len(step.MCP) > 0 {
+		return true // Shell is offered by default
+	}
+
+	for _, ref := range step.Tools {
+		switch {
+		case ref.Name == ToolShell, ref.Name == ToolWriteFile, ref.Name == ToolEditFile:
+			return true
+		case ref.Command != "":
+			if cmd, ok := config.Commands[ref.Command]; ok && needsConfirm(config, cmd, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
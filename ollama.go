@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OllamaProvider talks to a local Ollama server using its native chat API
+type OllamaProvider struct {
+	baseURL string
+	model   string
+}
+
+// NewOllamaProvider creates a provider for the ollama auth type
+func NewOllamaProvider(pc ProviderConfig) *OllamaProvider {
+	baseURL := pc.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultOllamaBaseURL
+	}
+	model := pc.Model
+	if model == "" {
+		model = DefaultModelOllama
+	}
+	return &OllamaProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+	}
+}
+
+// Name returns the provider type
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+// DefaultModel returns the configured model
+func (p *OllamaProvider) DefaultModel() string {
+	return p.model
+}
+
+// ollamaMessage is an Ollama chat message
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// ollamaToolCall is a function call made by the model (arguments are an object, not a string)
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaChunk is a streamed chat response line
+type ollamaChunk struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int64         `json:"prompt_eval_count"`
+	EvalCount       int64         `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// Complete sends a streaming /api/chat request
+func (p *OllamaProvider) Complete(ctx context.Context, req CompletionRequest, onText func(string)) (*CompletionResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.model
+	}
+
+	options := map[string]any{}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+
+	body := map[string]any{
+		"model":    model,
+		"messages": ollamaMessages(req.System, req.Messages),
+		"stream":   true,
+		"options":  options,
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = openAITools(req.Tools)
+	}
+
+	httpResp, err := postJSON(ctx, p.baseURL+"/api/chat", body, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	resp := &CompletionResponse{}
+	var text strings.Builder
+	var calls []ollamaToolCall
+
+	// The response is newline-delimited JSON
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk ollamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return ollamaResponse(resp, text.String(), calls), fmt.Errorf("invalid stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return ollamaResponse(resp, text.String(), calls), fmt.Errorf("ollama: %s", chunk.Error)
+		}
+
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			if onText != nil {
+				onText(chunk.Message.Content)
+			}
+		}
+		calls = append(calls, chunk.Message.ToolCalls...)
+
+		if chunk.Done {
+			resp.Usage.InputTokens = chunk.PromptEvalCount
+			resp.Usage.OutputTokens = chunk.EvalCount
+			switch {
+			case len(calls) > 0:
+				resp.StopReason = StopToolUse
+			case chunk.DoneReason == "length":
+				resp.StopReason = StopMaxTokens
+			default:
+				resp.StopReason = StopEndTurn
+			}
+			break
+		}
+	}
+
+	return ollamaResponse(resp, text.String(), calls), scanner.Err()
+}
+
+// ollamaResponse assembles the accumulated text and tool calls into a response
+func ollamaResponse(resp *CompletionResponse, text string, calls []ollamaToolCall) *CompletionResponse {
+	resp.Content = nil
+	if text != "" {
+		resp.Content = append(resp.Content, ContentBlock{Type: BlockText, Text: text})
+	}
+
+	// Ollama doesn't assign tool call IDs, so generate them
+	for i, call := range calls {
+		args := call.Function.Arguments
+		if len(args) == 0 || string(args) == "null" {
+			args = json.RawMessage("{}")
+		}
+		resp.Content = append(resp.Content, ContentBlock{
+			Type:     BlockToolUse,
+			ToolID:   fmt.Sprintf("call_%d", i),
+			ToolName: call.Function.Name,
+			Input:    args,
+		})
+	}
+
+	return resp
+}
+
+// ollamaMessages converts neutral messages to Ollama chat messages
+func ollamaMessages(system string, messages []Message) []ollamaMessage {
+	var result []ollamaMessage
+	if system != "" {
+		result = append(result, ollamaMessage{Role: "system", Content: system})
+	}
+
+	for _, msg := range messages {
+		out := ollamaMessage{Role: msg.Role}
+		for _, block := range msg.Content {
+			switch block.Type {
+			case BlockText:
+				out.Content += block.Text
+			case BlockToolUse:
+				var call ollamaToolCall
+				call.Function.Name = block.ToolName
+				call.Function.Arguments = block.Input
+				out.ToolCalls = append(out.ToolCalls, call)
+			case BlockToolResult:
+				result = append(result, ollamaMessage{Role: "tool", ToolName: block.ToolName, Content: block.Text})
+			}
+		}
+		if out.Content != "" || len(out.ToolCalls) > 0 {
+			result = append(result, out)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// OpenAIProvider talks to any OpenAI-compatible Chat Completions endpoint
+// (OpenAI, vLLM, LM Studio, llama.cpp server, ...)
+type OpenAIProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+}
+
+// NewOpenAIProvider creates a provider for the openai auth type
+func NewOpenAIProvider(pc ProviderConfig) *OpenAIProvider {
+	baseURL := pc.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	model := pc.Model
+	if model == "" {
+		model = DefaultModelOpenAI
+	}
+	return &OpenAIProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  pc.APIKey,
+		model:   model,
+	}
+}
+
+// Name returns the provider type
+func (p *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+// DefaultModel returns the configured model
+func (p *OpenAIProvider) DefaultModel() string {
+	return p.model
+}
+
+// openAIMessage is a Chat Completions message
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openAIToolCall is a function call made by the model
+type openAIToolCall struct {
+	Index    int    `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
+}
+
+// openAITool is a function tool definition (shared with Ollama)
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+// openAIChunk is a streamed Chat Completions chunk
+type openAIChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string           `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// Complete sends a streaming Chat Completions request
+func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest, onText func(string)) (*CompletionResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = p.model
+	}
+
+	body := map[string]any{
+		"model":          model,
+		"messages":       openAIMessages(req.System, req.Messages),
+		"stream":         true,
+		"stream_options": map[string]any{"include_usage": true},
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = openAITools(req.Tools)
+	}
+
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+
+	httpResp, err := postJSON(ctx, p.baseURL+"/chat/completions", body, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	resp := &CompletionResponse{}
+	var text strings.Builder
+	calls := make(map[int]*openAIToolCall)
+
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return openAIResponse(resp, text.String(), calls), fmt.Errorf("invalid stream chunk: %w", err)
+		}
+
+		if chunk.Usage != nil {
+			resp.Usage.InputTokens = chunk.Usage.PromptTokens
+			resp.Usage.OutputTokens = chunk.Usage.CompletionTokens
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				text.WriteString(choice.Delta.Content)
+				if onText != nil {
+					onText(choice.Delta.Content)
+				}
+			}
+
+			// Tool call arguments arrive in fragments keyed by index
+			for _, delta := range choice.Delta.ToolCalls {
+				call, ok := calls[delta.Index]
+				if !ok {
+					call = &openAIToolCall{}
+					calls[delta.Index] = call
+				}
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				if delta.Function.Name != "" {
+					call.Function.Name = delta.Function.Name
+				}
+				call.Function.Arguments += delta.Function.Arguments
+			}
+
+			switch choice.FinishReason {
+			case "":
+			case "tool_calls", "function_call":
+				resp.StopReason = StopToolUse
+			case "length":
+				resp.StopReason = StopMaxTokens
+			default:
+				resp.StopReason = StopEndTurn
+			}
+		}
+	}
+
+	return openAIResponse(resp, text.String(), calls), scanner.Err()
+}
+
+// openAIResponse assembles the accumulated text and tool calls into a response
+func openAIResponse(resp *CompletionResponse, text string, calls map[int]*openAIToolCall) *CompletionResponse {
+	resp.Content = nil
+	if text != "" {
+		resp.Content = append(resp.Content, ContentBlock{Type: BlockText, Text: text})
+	}
+
+	indexes := make([]int, 0, len(calls))
+	for index := range calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		call := calls[index]
+		id := call.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", index)
+		}
+		args := call.Function.Arguments
+		if strings.TrimSpace(args) == "" {
+			args = "{}"
+		}
+		resp.Content = append(resp.Content, ContentBlock{
+			Type:     BlockToolUse,
+			ToolID:   id,
+			ToolName: call.Function.Name,
+			Input:    json.RawMessage(args),
+		})
+	}
+
+	return resp
+}
+
+// openAIMessages converts neutral messages to Chat Completions messages
+func openAIMessages(system string, messages []Message) []openAIMessage {
+	var result []openAIMessage
+	if system != "" {
+		result = append(result, openAIMessage{Role: "system", Content: system})
+	}
+
+	for _, msg := range messages {
+		out := openAIMessage{Role: msg.Role}
+		for _, block := range msg.Content {
+			switch block.Type {
+			case BlockText:
+				out.Content += block.Text
+			case BlockToolUse:
+				call := openAIToolCall{ID: block.ToolID, Type: "function"}
+				call.Function.Name = block.ToolName
+				call.Function.Arguments = string(block.Input)
+				out.ToolCalls = append(out.ToolCalls, call)
+			case BlockToolResult:
+				// Each tool result is its own message
+				result = append(result, openAIMessage{Role: "tool", ToolCallID: block.ToolID, Content: block.Text})
+			}
+		}
+		if out.Content != "" || len(out.ToolCalls) > 0 {
+			result = append(result, out)
+		}
+	}
+
+	return result
+}
+
+// openAITools converts neutral tool definitions to function tools
+func openAITools(tools []ToolDef) []openAITool {
+	var result []openAITool
+	for _, def := range tools {
+		tool := openAITool{Type: "function"}
+		tool.Function.Name = def.Name
+		tool.Function.Description = def.Description
+		tool.Function.Parameters = toolSchema(def)
+		result = append(result, tool)
+	}
+	return result
+}
+
+// toolSchema returns the JSON schema for a tool's input object
+func toolSchema(def ToolDef) map[string]any {
+	properties := def.Properties
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(def.Required) > 0 {
+		schema["required"] = def.Required
+	}
+	return schema
+}
+
+// statusError is a non-2xx response to an HTTP request
+type statusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// postJSON sends a JSON POST request and returns the response, turning non-2xx statuses into errors
+func postJSON(ctx context.Context, url string, body any, headers map[string]string) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &statusError{URL: url, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+
+	return resp, nil
+}
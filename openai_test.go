@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// toolCall returns an OpenAI tool call with a function name and arguments
+func toolCall(id, name, args string) openAIToolCall {
+	call := openAIToolCall{ID: id, Type: "function"}
+	call.Function.Name = name
+	call.Function.Arguments = args
+	return call
+}
+
+func TestOpenAIResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		calls map[int]*openAIToolCall
+		want  []ContentBlock
+	}{
+		{
+			name: "text only",
+			text: "hello",
+			want: []ContentBlock{{Type: BlockText, Text: "hello"}},
+		},
+		{
+			name: "tool calls in index order",
+			calls: map[int]*openAIToolCall{
+				1: ptr(toolCall("b", "write_file", `{"path":"x"}`)),
+				0: ptr(toolCall("a", "shell", `{"command":"ls"}`)),
+			},
+			want: []ContentBlock{
+				{Type: BlockToolUse, ToolID: "a", ToolName: "shell", Input: json.RawMessage(`{"command":"ls"}`)},
+				{Type: BlockToolUse, ToolID: "b", ToolName: "write_file", Input: json.RawMessage(`{"path":"x"}`)},
+			},
+		},
+		{
+			name:  "missing id and arguments",
+			text:  "checking",
+			calls: map[int]*openAIToolCall{2: ptr(toolCall("", "shell", " "))},
+			want: []ContentBlock{
+				{Type: BlockText, Text: "checking"},
+				{Type: BlockToolUse, ToolID: "call_2", ToolName: "shell", Input: json.RawMessage(`{}`)},
+			},
+		},
+		{
+			name: "nothing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := openAIResponse(&CompletionResponse{StopReason: StopEndTurn}, tt.text, tt.calls)
+			if !reflect.DeepEqual(resp.Content, tt.want) {
+				t.Errorf("Content = %+v, want %+v", resp.Content, tt.want)
+			}
+			if resp.StopReason != StopEndTurn {
+				t.Errorf("StopReason = %q, want it kept", resp.StopReason)
+			}
+		})
+	}
+}
+
+func TestOpenAIMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		system   string
+		messages []Message
+		want     []openAIMessage
+	}{
+		{
+			name:     "system prompt first",
+			system:   "be brief",
+			messages: []Message{{Role: "user", Content: []ContentBlock{{Type: BlockText, Text: "hi"}}}},
+			want: []openAIMessage{
+				{Role: "system", Content: "be brief"},
+				{Role: "user", Content: "hi"},
+			},
+		},
+		{
+			name: "text blocks joined",
+			messages: []Message{{Role: "assistant", Content: []ContentBlock{
+				{Type: BlockText, Text: "one "},
+				{Type: BlockText, Text: "two"},
+			}}},
+			want: []openAIMessage{{Role: "assistant", Content: "one two"}},
+		},
+		{
+			name: "tool use and results",
+			messages: []Message{
+				{Role: "assistant", Content: []ContentBlock{
+					{Type: BlockText, Text: "listing"},
+					{Type: BlockToolUse, ToolID: "a", ToolName: "shell", Input: json.RawMessage(`{"command":"ls"}`)},
+				}},
+				{Role: "user", Content: []ContentBlock{
+					{Type: BlockToolResult, ToolID: "a", Text: "file.txt"},
+					{Type: BlockToolResult, ToolID: "b", Text: "done"},
+				}},
+			},
+			want: []openAIMessage{
+				{Role: "assistant", Content: "listing", ToolCalls: []openAIToolCall{toolCall("a", "shell", `{"command":"ls"}`)}},
+				{Role: "tool", ToolCallID: "a", Content: "file.txt"},
+				{Role: "tool", ToolCallID: "b", Content: "done"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := openAIMessages(tt.system, tt.messages)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("openAIMessages() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ptr returns a pointer to a copy of v
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RunOptions are the options x runs commands with. Global flags set them,
+// with environment variables as defaults.
+type RunOptions struct {
+	DryRun    bool   // Show what would run without running anything (--dry-run, DRYRUN)
+	Debug     bool   // Print prompts and step details (--debug, DEBUG)
+	PrintOnly bool   // Print commands that need confirmation instead of running them (X_PRINT_COMMAND)
+	Model     string // Model for every LLM call, instead of the configured ones (--model)
+	Quiet     bool   // Don't show commands and tool calls as they run (--quiet)
+	Output    string // text, json or jsonl; with json(l), only JSON goes to stdout (--output, --json)
+	Confirm   string // Confirmation policy (--yes, --no-input, X_CONFIRM_POLICY)
+}
+
+// jsonResult is what --json prints when a command finishes
+type jsonResult struct {
+	Command  string      `json:"command"`
+	Status   string      `json:"status"`    // succeeded, failed, cancelled or interrupted
+	ExitCode int         `json:"exit_code"` // What x exits with
+	Output   string      `json:"output"`
+	Error    string      `json:"error,omitempty"`
+	Usage    *TokenUsage `json:"usage"`
+}
+
+// Output settings apply to everything x prints, so they're process-wide
+var (
+	debugMode bool
+	quietMode bool
+)
+
+// envFlag reports whether a boolean environment variable is set
+func envFlag(name string) bool {
+	val := os.Getenv(name)
+	return val != "" && val != "0" && val != "false"
+}
+
+// optionsFromEnv returns the options set by environment variables
+func optionsFromEnv() RunOptions {
+	return RunOptions{
+		DryRun:    envFlag(EnvDryRun),
+		Debug:     envFlag(EnvDebug),
+		PrintOnly: envFlag(EnvPrintCommand),
+		Confirm:   os.Getenv(EnvConfirmPolicy),
+	}
+}
+
+// parseGlobalFlags reads the global flags before the command, on top of the
+// options from the environment. It returns the remaining args, starting with
+// the command; flags after it belong to the command.
+func parseGlobalFlags(args []string) ([]string, RunOptions, error) {
+	opts := optionsFromEnv()
+	for len(args) > 0 {
+		flag, value, hasValue := strings.Cut(args[0], "=")
+		switch flag {
+		case FlagDryRun:
+			opts.DryRun = true
+		case FlagDebug:
+			opts.Debug = true
+		case FlagQuiet, FlagQuietShort:
+			opts.Quiet = true
+		case FlagJSON:
+			opts.Output = OutputJSON
+		case FlagYes, FlagYesShort:
+			opts.Confirm = ConfirmNever
+		case FlagNoInput:
+			opts.Confirm = ConfirmNoInput
+		case FlagModel, FlagOutput:
+			if !hasValue {
+				if len(args) < 2 {
+					return nil, opts, fmt.Errorf("%s needs a value", flag)
+				}
+				value = args[1]
+				args = args[1:]
+			}
+			if flag == FlagModel {
+				opts.Model = value
+				break
+			}
+			if value != OutputText && value != OutputJSON && value != OutputJSONL {
+				return nil, opts, fmt.Errorf("%s must be %s, %s or %s", FlagOutput, OutputText, OutputJSON, OutputJSONL)
+			}
+			opts.Output = value
+		case "--":
+			return args[1:], opts, nil
+		default:
+			return args, opts, nil
+		}
+		if hasValue && flag != FlagModel && flag != FlagOutput {
+			return nil, opts, fmt.Errorf("%s doesn't take a value", flag)
+		}
+		args = args[1:]
+	}
+	return args, opts, nil
+}
+
+// apply sets the process-wide settings from the options
+func (o RunOptions) apply() error {
+	debugMode = o.Debug
+	quietMode = o.Quiet
+	if os.Getenv(EnvNoColor) != "" {
+		disableColors()
+	}
+	return resolveConfirmPolicy(o.Confirm)
+}
+
+// runCommand runs a command from the command line. With --output json or
+// jsonl, everything it prints goes to stderr, leaving stdout for JSON: its
+// result as an object (json), or its events as lines ending in run_finished (jsonl).
+func runCommand(providers *Providers, config *CommandsConfig, cmd Command, args []string, opts RunOptions) error {
+	if opts.Output != OutputJSON && opts.Output != OutputJSONL {
+		_, err := RunPipeline(providers, config, cmd, args, opts, false)
+		return err
+	}
+
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	activeEvents = newEventStream(stdout, opts.Output == OutputJSONL)
+	output, err := RunPipeline(providers, config, cmd, args, opts, true)
+	events := activeEvents
+	activeEvents = nil
+	os.Stdout = stdout
+
+	result := jsonResult{Command: cmd.Name, Status: runStatus(err), ExitCode: exitCodeFor(err), Output: output, Usage: &events.usage}
+	if err != nil && result.Status != RunSucceeded {
+		result.Error = err.Error()
+	}
+	if events.stream {
+		events.runFinished(result)
+	} else {
+		json.NewEncoder(os.Stdout).Encode(result)
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGlobalFlags(t *testing.T) {
+	for _, name := range []string{EnvDryRun, EnvDebug, EnvPrintCommand, EnvConfirmPolicy} {
+		t.Setenv(name, "")
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantArgs []string
+		wantOpts RunOptions
+		wantErr  bool
+	}{
+		{"no flags", []string{"deploy", "staging"}, []string{"deploy", "staging"}, RunOptions{}, false},
+		{"boolean flags", []string{"--dry-run", "--debug", "-q", "deploy"}, []string{"deploy"}, RunOptions{DryRun: true, Debug: true, Quiet: true}, false},
+		{"--json", []string{"--json", "deploy"}, []string{"deploy"}, RunOptions{Output: OutputJSON}, false},
+		{"--output value", []string{"--output", "jsonl", "deploy"}, []string{"deploy"}, RunOptions{Output: OutputJSONL}, false},
+		{"--output=value", []string{"--output=text", "deploy"}, []string{"deploy"}, RunOptions{Output: OutputText}, false},
+		{"unknown output", []string{"--output", "xml", "deploy"}, nil, RunOptions{}, true},
+		{"--model value", []string{"--model", "gpt-4o", "deploy"}, []string{"deploy"}, RunOptions{Model: "gpt-4o"}, false},
+		{"--model=value", []string{"--model=gpt-4o"}, []string{}, RunOptions{Model: "gpt-4o"}, false},
+		{"missing value", []string{"--model"}, nil, RunOptions{}, true},
+		{"--yes", []string{"-y", "deploy"}, []string{"deploy"}, RunOptions{Confirm: ConfirmNever}, false},
+		{"--no-input", []string{"--no-input", "deploy"}, []string{"deploy"}, RunOptions{Confirm: ConfirmNoInput}, false},
+		{"value on a boolean flag", []string{"--yes=1", "deploy"}, nil, RunOptions{}, true},
+		{"flags after the command", []string{"deploy", "--dry-run"}, []string{"deploy", "--dry-run"}, RunOptions{}, false},
+		{"end of flags", []string{"--", "--dry-run"}, []string{"--dry-run"}, RunOptions{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, opts, err := parseGlobalFlags(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGlobalFlags(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %q, want %q", args, tt.wantArgs)
+			}
+			if opts != tt.wantOpts {
+				t.Errorf("opts = %+v, want %+v", opts, tt.wantOpts)
+			}
+		})
+	}
+}
+
+func TestParseGlobalFlagsEnv(t *testing.T) {
+	t.Setenv(EnvDryRun, "1")
+	t.Setenv(EnvDebug, "false")
+	t.Setenv(EnvPrintCommand, "")
+	t.Setenv(EnvConfirmPolicy, ConfirmDenyRisky)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantOpts RunOptions
+	}{
+		{"environment defaults", []string{"deploy"}, RunOptions{DryRun: true, Confirm: ConfirmDenyRisky}},
+		{"flags override", []string{"--yes", "--debug", "deploy"}, RunOptions{DryRun: true, Debug: true, Confirm: ConfirmNever}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, opts, err := parseGlobalFlags(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts != tt.wantOpts {
+				t.Errorf("opts = %+v, want %+v", opts, tt.wantOpts)
+			}
+		})
+	}
+}
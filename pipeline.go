@@ -1,53 +1,44 @@
 package main
 
 import (
-	"bufio"
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
 	"strings"
 
-	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/charmbracelet/glamour"
 	"golang.org/x/term"
 )
 
-// isDebug returns true if DEBUG environment variable is set
+// isDebug reports whether debug output is on (--debug or DEBUG)
 func isDebug() bool {
-	val := os.Getenv("DEBUG")
-	return val != "" && val != "0" && val != "false"
+	return debugMode
 }
 
-// isDryRun returns true if DRYRUN environment variable is set
-func isDryRun() bool {
-	val := os.Getenv("DRYRUN")
-	return val != "" && val != "0" && val != "false"
-}
-
-// debugLog prints debug information when DEBUG is enabled
+// debugLog prints debug information to stderr when DEBUG is enabled
 func debugLog(format string, args ...any) {
 	if isDebug() {
-		fmt.Printf("[DEBUG] "+format+"\n", args...)
+		fmt.Fprintf(os.Stderr, "[DEBUG] "+format+"\n", args...)
 	}
 }
 
 // debugSection prints a debug section header
 func debugSection(title string) {
 	if isDebug() {
-		fmt.Printf("\n[DEBUG] === %s ===\n", title)
+		fmt.Fprintf(os.Stderr, "\n[DEBUG] === %s ===\n", title)
 	}
 }
 
 // debugPrompt prints prompt content in debug mode
 func debugPrompt(label, content string) {
 	if isDebug() {
-		fmt.Printf("[DEBUG] %s:\n", label)
+		fmt.Fprintf(os.Stderr, "[DEBUG] %s:\n", label)
 		// Indent the content
 		lines := strings.Split(content, "\n")
 		for _, line := range lines {
-			fmt.Printf("[DEBUG]   %s\n", line)
+			fmt.Fprintf(os.Stderr, "[DEBUG]   %s\n", line)
 		}
 	}
 }
@@ -62,7 +53,7 @@ func isRiskyCommand(risk string) bool {
 func printConfirmInfo(summary, risk, safer string) {
 	// Print summary if present
 	if summary != "" {
-		fmt.Printf("\n\033[1mSummary:\033[0m %s\n", summary)
+		fmt.Printf("\n"+ansiBold+"Summary:"+ansiReset+" %s\n", summary)
 	}
 
 	// Only show risk and safer alternative for medium/high risk commands
@@ -72,26 +63,40 @@ func printConfirmInfo(summary, risk, safer string) {
 		var color string
 		switch {
 		case strings.HasPrefix(riskLower, "medium"):
-			color = "\033[38;5;208m" // Orange
+			color = ansiOrange
 		case strings.HasPrefix(riskLower, "high"):
-			color = "\033[31m" // Red
+			color = ansiRed
 		default:
-			color = "\033[0m"
+			color = ansiReset
 		}
-		fmt.Printf("\033[1mRisk:\033[0m %s%s\033[0m\n", color, risk)
+		fmt.Printf(ansiBold+"Risk:"+ansiReset+" %s%s"+ansiReset+"\n", color, risk)
 
 		// Print safer alternative if present
 		if safer != "" {
-			fmt.Printf("\033[1mSafer alternative:\033[0m %s\n", safer)
+			fmt.Printf(ansiBold+"Safer alternative:"+ansiReset+" %s\n", safer)
 		}
 	}
 }
 
 // PipelineContext tracks state during pipeline execution
 type PipelineContext struct {
+	Command     string            // Name of the command being run
+	StepID      string            // ID of the step being run (step-N if it has none)
 	Args        map[string]string // Parsed argument name -> value
 	StepOutputs map[string]string // Step ID -> output
 	LastOutput  string            // Output from previous step
+	LastLLM     *LLMCall          // Previous step's LLM call, if it was an llm step (used to refine commands)
+	History     bool              // Record approved commands in the shell history (built-in shell command)
+	Options     RunOptions        // Options the command runs with
+}
+
+// LLMCall records the prompts and response of an llm step
+type LLMCall struct {
+	StepID   string
+	Provider Provider
+	System   string
+	Prompt   string
+	Output   string
 }
 
 // NewPipelineContext creates a new pipeline context
@@ -105,10 +110,16 @@ func NewPipelineContext() *PipelineContext {
 // RunPipeline executes all steps in a command pipeline
 // Returns the final step's output and any error
 // If captureOutput is true, the last step will use streaming instead of interactive mode
-func RunPipeline(client anthropic.Client, authType AuthType, config *CommandsConfig, cmd Command, userArgs []string, captureOutput bool) (string, error) {
+func RunPipeline(providers *Providers, config *CommandsConfig, cmd Command, userArgs []string, opts RunOptions, captureOutput bool) (output string, err error) {
 	ctx := NewPipelineContext()
+	ctx.Command = cmd.Name
+	ctx.Options = opts
 
-	if isDryRun() {
+	if run := beginRun(cmd, userArgs, opts); run != nil {
+		defer func() { run.end(err) }()
+	}
+
+	if ctx.Options.DryRun {
 		fmt.Println("[DRYRUN] Dry run mode - no commands will be executed")
 	}
 
@@ -122,6 +133,16 @@ func RunPipeline(client anthropic.Client, authType AuthType, config *CommandsCon
 
 	debugLog("Parsed args: %v", ctx.Args)
 
+	// The shell command can reuse the command generated for the same query before
+	if isShellCommand(cmd) {
+		ctx.History = true
+		if !captureOutput && !ctx.Options.PrintOnly {
+			if used, err := offerCachedCommand(providers, ctx.Args["query"], opts); used {
+				return "", err
+			}
+		}
+	}
+
 	// Execute each step
 	for i, step := range cmd.Steps {
 		var output string
@@ -131,28 +152,48 @@ func RunPipeline(client anthropic.Client, authType AuthType, config *CommandsCon
 		if stepID == "" {
 			stepID = fmt.Sprintf("step-%d", i+1)
 		}
+		ctx.StepID = stepID
 
 		isLastStep := i == len(cmd.Steps)-1
 
+		mocked, isMocked := activeTest.mockedStep(ctx.stepName())
+		if !isMocked {
+			activeTest.startStep(ctx.stepName())
+		}
+		activeRun.startStep(ctx.stepName(), stepType(step))
+		activeEvents.stepStarted(ctx.stepName(), stepType(step))
+
 		switch {
+		case isMocked:
+			debugSection(fmt.Sprintf("Step %d: mocked (id=%s)", i+1, stepID))
+			output = mocked
+			ctx.LastLLM = nil
 		case step.Exec != nil:
 			debugSection(fmt.Sprintf("Step %d: exec (id=%s)", i+1, stepID))
-			output, err = runExecStep(ctx, step.Exec, isLastStep, captureOutput)
+			output, err = runExecStep(providers, ctx, step.Exec, isLastStep, captureOutput)
 		case step.LLM != nil:
 			debugSection(fmt.Sprintf("Step %d: llm (id=%s)", i+1, stepID))
-			output, err = runLLMStep(client, authType, ctx, step.LLM)
+			output, err = runLLMStep(providers, ctx, step.LLM)
+			if ctx.LastLLM != nil {
+				ctx.LastLLM.StepID = step.ID
+			}
 		case step.Agentic != nil:
 			debugSection(fmt.Sprintf("Step %d: agentic (id=%s)", i+1, stepID))
-			output, err = runAgenticStep(client, authType, ctx, step.Agentic)
+			output, err = runAgenticStep(providers, config, ctx, step.Agentic)
 		case step.Subcommand != nil:
 			debugSection(fmt.Sprintf("Step %d: subcommand (id=%s)", i+1, stepID))
-			output, err = runSubcommandStep(client, authType, config, ctx, step.Subcommand)
+			output, err = runSubcommandStep(providers, config, ctx, step.Subcommand)
 		default:
-			return "", fmt.Errorf("step %d has no valid type (exec, llm, agentic, or subcommand)", i+1)
+			err = &ConfigError{Err: fmt.Errorf("%s: step %d has no valid type (exec, llm, agentic, or subcommand)", cmd.Name, i+1)}
+			activeRun.endStep(err)
+			activeEvents.stepFinished(err)
+			return "", err
 		}
 
+		activeRun.endStep(err)
+		activeEvents.stepFinished(err)
 		if err != nil {
-			return "", fmt.Errorf("step %d failed: %w", i+1, err)
+			return "", &StepError{Step: i + 1, ID: stepID, Err: err}
 		}
 
 		// Store output
@@ -160,17 +201,26 @@ func RunPipeline(client anthropic.Client, authType AuthType, config *CommandsCon
 		if step.ID != "" {
 			ctx.StepOutputs[step.ID] = output
 		}
+		if step.LLM == nil {
+			// Only a directly preceding llm step can be refined
+			ctx.LastLLM = nil
+		}
 
 		debugLog("Step output length: %d bytes", len(output))
 	}
 
-	if isDryRun() {
+	if ctx.Options.DryRun {
 		fmt.Println("[DRYRUN] Dry run complete")
 	}
 
 	return ctx.LastOutput, nil
 }
 
+// stepName returns the current step's name for fixtures and scripted responses
+func (ctx *PipelineContext) stepName() string {
+	return ctx.Command + "." + ctx.StepID
+}
+
 // parseArgs parses user arguments into the pipeline context
 func parseArgs(ctx *PipelineContext, argDefs []Arg, userArgs []string) error {
 	argIndex := 0
@@ -218,7 +268,7 @@ func getOSCommand(step *ExecStep) string {
 // runExecStep executes a shell command step
 // If isLastStep is true and captureOutput is false, runs interactively with terminal connected
 // If captureOutput is true, always captures output (for command chaining)
-func runExecStep(ctx *PipelineContext, step *ExecStep, isLastStep bool, captureOutput bool) (string, error) {
+func runExecStep(providers *Providers, ctx *PipelineContext, step *ExecStep, isLastStep bool, captureOutput bool) (string, error) {
 	command := getOSCommand(step)
 	var err error
 	command, err = interpolateVariables(command, ctx)
@@ -229,7 +279,7 @@ func runExecStep(ctx *PipelineContext, step *ExecStep, isLastStep bool, captureO
 	debugLog("Command: %s", command)
 	debugLog("Confirm: %v, Silent: %v, IsLastStep: %v, CaptureOutput: %v", step.Confirm, step.Silent, isLastStep, captureOutput)
 
-	if isDryRun() {
+	if ctx.Options.DryRun {
 		fmt.Printf("[DRYRUN] Would execute: %s\n", command)
 		// Show optional fields if present
 		if step.Summary != "" {
@@ -247,43 +297,62 @@ func runExecStep(ctx *PipelineContext, step *ExecStep, isLastStep bool, captureO
 		return "[dry run - no output]", nil
 	}
 
+	activeTest.recordExec(command, step.Confirm)
+
+	// Hand the command to the caller (a shell widget) to run, and stop
+	if step.Confirm && ctx.Options.PrintOnly {
+		fmt.Println(command)
+		return command, ErrCommandPrinted
+	}
+
 	if step.Confirm {
-		// Interpolate optional summary/risk/safer fields
-		summary, _ := interpolateVariables(step.Summary, ctx)
-		risk, _ := interpolateVariables(step.Risk, ctx)
-		safer, _ := interpolateVariables(step.Safer, ctx)
-
-		// Display confirmation info
-		printConfirmInfo(summary, risk, safer)
-		printCommandForConfirm(command)
-
-		reader := bufio.NewReader(os.Stdin)
-		isHighRisk := isRiskyCommand(risk)
-
-		if isHighRisk {
-			// For medium/high risk: default to No, require explicit Y
-			fmt.Print("Run this command? [y/N]: ")
-			response, _ := reader.ReadString('\n')
-			response = strings.TrimSpace(strings.ToLower(response))
-
-			if response != "y" && response != "yes" {
-				fmt.Println("Cancelled.")
-				os.Exit(0)
+		for {
+			// Interpolate optional summary/risk/safer fields
+			summary, _ := interpolateVariables(step.Summary, ctx)
+			risk, _ := interpolateVariables(step.Risk, ctx)
+			safer, _ := interpolateVariables(step.Safer, ctx)
+
+			review := newCommandReview(providers, command, summary, risk, safer)
+			review.CanRefine = ctx.LastLLM != nil
+
+			outcome, feedback := review.Prompt()
+			if outcome == reviewRun {
+				command = review.Command
+				if ctx.History {
+					recordHistory(ctx.Args["query"], review, HistoryApproved)
+				}
+				break
 			}
-		} else {
-			// For none/low risk: default to Yes
-			fmt.Print("Run this command? [Y/n]: ")
-			response, _ := reader.ReadString('\n')
-			response = strings.TrimSpace(strings.ToLower(response))
-
-			if response == "n" || response == "no" {
-				fmt.Println("Cancelled.")
-				os.Exit(0)
+			if outcome == reviewCancel {
+				if ctx.History {
+					recordHistory(ctx.Args["query"], review, review.declinedStatus())
+				}
+				return "", review.cancelled()
+			}
+
+			// Regenerate the previous llm step's output and re-interpolate the command
+			if err := refineLLMOutput(ctx, feedback); err != nil {
+				return "", fmt.Errorf("failed to refine command: %w", err)
+			}
+			command, err = interpolateVariables(getOSCommand(step), ctx)
+			if err != nil {
+				return "", fmt.Errorf("failed to interpolate command: %w", err)
 			}
 		}
-		fmt.Println()
 	}
 
+	if output, mocked, err := activeTest.mockedExec(command); mocked {
+		return output, err
+	}
+
+	output, err := runExecCommand(command, step, isLastStep, captureOutput)
+	activeRun.recordExec(command, step.Confirm, err)
+	activeEvents.execFinished(command, err)
+	return output, err
+}
+
+// runExecCommand runs an exec step's command, showing and capturing its output as the step requires
+func runExecCommand(command string, step *ExecStep, isLastStep bool, captureOutput bool) (string, error) {
 	// For the last step without silent, run interactively with terminal connected
 	// Unless captureOutput is true (nested command call), then use streaming to capture output
 	if isLastStep && !step.Silent {
@@ -318,7 +387,7 @@ func runExecStep(ctx *PipelineContext, step *ExecStep, isLastStep bool, captureO
 }
 
 // runLLMStep executes a single LLM call step
-func runLLMStep(client anthropic.Client, authType AuthType, ctx *PipelineContext, step *LLMStep) (string, error) {
+func runLLMStep(providers *Providers, ctx *PipelineContext, step *LLMStep) (string, error) {
 	systemPrompt, err := interpolateVariables(step.System, ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to interpolate system prompt: %w", err)
@@ -334,28 +403,75 @@ func runLLMStep(client anthropic.Client, authType AuthType, ctx *PipelineContext
 	debugPrompt("System prompt", systemPrompt)
 	debugPrompt("User prompt", prompt)
 
-	if isDryRun() {
+	if ctx.Options.DryRun {
 		fmt.Println("[DRYRUN] Would call LLM with:")
 		fmt.Println("[DRYRUN]   System prompt length:", len(systemPrompt), "bytes")
 		fmt.Println("[DRYRUN]   User prompt length:", len(prompt), "bytes")
 		return "[dry run - no LLM response]", nil
 	}
 
-	response, err := GenerateResponse(client, authType, systemPrompt, prompt)
+	provider, err := providers.ForStep(ctx.stepName(), step.Provider, step.Model)
 	if err != nil {
 		return "", err
 	}
+	debugLog("Provider: %s, model: %s", provider.Name(), provider.DefaultModel())
 
-	// Render markdown for LLM output unless silent
+	// Stream rendered markdown for LLM output unless silent
+	var onText func(string)
+	var md *markdownStream
 	if !step.Silent {
-		renderMarkdown(response)
+		md = newMarkdownStream()
+		onText = md.Write
 	}
 
+	response, err := GenerateResponse(provider, systemPrompt, prompt, onText)
+	if md != nil {
+		md.Flush()
+	}
+	if errors.Is(err, ErrInterrupted) {
+		printInterrupted()
+		return response, err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ctx.LastLLM = &LLMCall{Provider: provider, System: systemPrompt, Prompt: prompt, Output: response}
+
 	return response, nil
 }
 
+// refineLLMOutput re-runs the previous llm step with the user's feedback and
+// replaces its output in the pipeline context
+func refineLLMOutput(ctx *PipelineContext, feedback string) error {
+	call := ctx.LastLLM
+	prompt := fmt.Sprintf(`%s
+
+Your previous response was:
+%s
+
+The user wants changes: %s
+
+Respond again in exactly the same format, taking the feedback into account.`, call.Prompt, call.Output, feedback)
+
+	debugPrompt("Refine prompt", prompt)
+
+	output, err := GenerateResponse(call.Provider, call.System, prompt, nil)
+	if err != nil {
+		return err
+	}
+
+	call.Output = output
+	ctx.LastOutput = output
+	if call.StepID != "" {
+		ctx.StepOutputs[call.StepID] = output
+	}
+
+	return nil
+}
+
 // runAgenticStep executes a multi-turn agentic loop
-func runAgenticStep(client anthropic.Client, authType AuthType, ctx *PipelineContext, step *AgenticStep) (string, error) {
+func runAgenticStep(providers *Providers, config *CommandsConfig, ctx *PipelineContext, step *AgenticStep) (string, error) {
 	systemPrompt, err := interpolateVariables(step.System, ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to interpolate system prompt: %w", err)
@@ -378,105 +494,168 @@ func runAgenticStep(client anthropic.Client, authType AuthType, ctx *PipelineCon
 	debugLog("Max iterations: %d", maxIterations)
 	debugLog("Auto execute: %v", step.AutoExecute)
 
-	if isDryRun() {
+	tools, err := BuildAgenticTools(step.Tools, config)
+	if err != nil {
+		return "", err
+	}
+	servers, err := resolveMCPServers(step.MCP, config)
+	if err != nil {
+		return "", err
+	}
+
+	if ctx.Options.DryRun {
 		fmt.Println("[DRYRUN] Would start agentic loop with:")
 		fmt.Println("[DRYRUN]   System prompt length:", len(systemPrompt), "bytes")
 		fmt.Println("[DRYRUN]   User prompt length:", len(prompt), "bytes")
 		fmt.Println("[DRYRUN]   Max iterations:", maxIterations)
 		fmt.Println("[DRYRUN]   Auto execute:", step.AutoExecute)
-		fmt.Println("[DRYRUN]   Tools: shell, complete")
+		fmt.Println("[DRYRUN]   Tools:", strings.Join(toolNames(tools), ", "))
+		if len(servers) > 0 {
+			fmt.Println("[DRYRUN]   MCP servers:", strings.Join(mcpServerNames(servers), ", "))
+		}
 		return "[dry run - no agentic execution]", nil
 	}
 
-	tools := BuildAgenticTools()
-	messages := []anthropic.MessageParam{
-		anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
+	provider, err := providers.ForStep(ctx.stepName(), step.Provider, step.Model)
+	if err != nil {
+		return "", err
 	}
+	debugLog("Provider: %s, model: %s", provider.Name(), provider.DefaultModel())
 
+	if len(servers) > 0 {
+		var stopServers func()
+		tools, stopServers, err = startMCPTools(servers, tools)
+		if err != nil {
+			return "", err
+		}
+		defer stopServers()
+	}
+	debugLog("Tools: %s", strings.Join(toolNames(tools), ", "))
+
+	tc := &toolContext{
+		providers:     providers,
+		config:        config,
+		autoExecute:   step.AutoExecute,
+		allowCommands: compileCommandPatterns(step.AllowCommands),
+		denyCommands:  compileCommandPatterns(step.DenyCommands),
+		options:       ctx.Options,
+	}
+	transcript := newAgentTranscript(ctx, step, servers, provider.DefaultModel(), systemPrompt, prompt)
+	activeRun.setTranscript(transcript.ID)
+
+	return runAgentLoop(provider, tools, tc, transcript, maxIterations)
+}
+
+// runAgentLoop runs an agent until it calls complete, stops calling tools or
+// reaches maxIterations. The transcript is saved as the conversation goes.
+func runAgentLoop(provider Provider, tools []agentTool, tc *toolContext, transcript *AgentTranscript, maxIterations int) (string, error) {
 	var lastTextBlock string // Track last text for fallback output
 	var finalOutput string   // The actual output (from complete tool)
-	bgCtx := context.Background()
+
+	transcript.Status = AgentRunning
+	transcript.save()
 
 	for iteration := 0; iteration < maxIterations; iteration++ {
 		debugLog("Agentic iteration %d/%d", iteration+1, maxIterations)
 
-		response, err := client.Messages.New(bgCtx, anthropic.MessageNewParams{
-			Model:     anthropic.Model(ModelForAuth(authType)),
+		// Stream text blocks to the terminal as they arrive
+		md := newMarkdownStream()
+		ctx, stop := interruptContext()
+		response, err := complete(ctx, provider, CompletionRequest{
+			System:    transcript.System,
+			Messages:  transcript.Messages,
+			Tools:     toolDefs(tools),
 			MaxTokens: AgenticMaxTokens,
-			System: []anthropic.TextBlockParam{
-				{Text: systemPrompt},
-			},
-			Messages: messages,
-			Tools:    tools,
-		})
+		}, md.Write)
+		stop()
+		md.Flush()
+		transcript.addUsage(response.Usage)
+
+		if errors.Is(err, ErrInterrupted) {
+			printInterrupted()
+			if text := strings.TrimSpace(md.String()); text != "" {
+				lastTextBlock = text
+			}
+			transcript.finish(AgentInterrupted, lastTextBlock)
+			transcript.printResumeHint()
+			return lastTextBlock, err
+		}
 		if err != nil {
+			transcript.finish(AgentFailed, lastTextBlock)
 			return lastTextBlock, err
 		}
 
-		// Track usage
-		trackUsage(response.Usage)
-
 		// Process response content
-		var toolResults []anthropic.ContentBlockParamUnion
-		var assistantBlocks []anthropic.ContentBlockParamUnion
+		var toolResults []ContentBlock
 		completed := false
 
 		for _, block := range response.Content {
 			switch block.Type {
-			case "text":
-				text := block.Text
-				lastTextBlock = text // Keep track of last text for fallback
-				renderMarkdown(text)
-				assistantBlocks = append(assistantBlocks, anthropic.NewTextBlock(text))
-
-			case "tool_use":
-				toolName := block.Name
-				toolID := block.ID
-				input := block.Input
-
-				debugLog("Tool call: %s (id=%s)", toolName, toolID)
-				debugLog("Tool input: %s", string(input))
-
-				// Add tool use block to assistant message
-				assistantBlocks = append(assistantBlocks, anthropic.NewToolUseBlock(toolID, input, toolName))
-
-				switch toolName {
-				case ToolShell:
-					result, isError := handleShellTool(input, step.AutoExecute)
-					toolResults = append(toolResults, anthropic.NewToolResultBlock(toolID, result, isError))
-
-				case ToolComplete:
-					finalOutput = extractOutput(input)
+			case BlockText:
+				lastTextBlock = block.Text // Keep track of last text for fallback (already rendered while streaming)
+
+			case BlockToolUse:
+				debugLog("Tool call: %s (id=%s)", block.ToolName, block.ToolID)
+				debugLog("Tool input: %s", string(block.Input))
+				activeEvents.toolCall(block.ToolName, block.Input)
+
+				if block.ToolName == ToolComplete {
+					finalOutput = extractOutput(block.Input)
 					completed = true
-					toolResults = append(toolResults, anthropic.NewToolResultBlock(toolID, "Workflow completed.", false))
+					toolResults = append(toolResults, NewToolResult(block, "Workflow completed.", false))
+					continue
+				}
+
+				if tc.stopErr != nil {
+					toolResults = append(toolResults, NewToolResult(block, fmt.Sprintf("Not run: %v", tc.stopErr), true))
+					continue
 				}
+				handle, ok := findTool(tools, block.ToolName)
+				if !ok {
+					toolResults = append(toolResults, NewToolResult(block, fmt.Sprintf("Unknown tool: %s", block.ToolName), true))
+					continue
+				}
+				result, isError := handle(tc, block.Input)
+				toolResults = append(toolResults, NewToolResult(block, result, isError))
 			}
 		}
 
-		if completed {
-			return finalOutput, nil
+		transcript.Messages = append(transcript.Messages, Message{Role: RoleAssistant, Content: response.Content})
+		if len(toolResults) > 0 {
+			transcript.Messages = append(transcript.Messages, Message{Role: RoleUser, Content: toolResults})
 		}
+		transcript.Iterations++
 
-		// If there were tool calls, add assistant message and tool results
-		if len(toolResults) > 0 {
-			messages = append(messages, anthropic.NewAssistantMessage(assistantBlocks...))
-			messages = append(messages, anthropic.NewUserMessage(toolResults...))
+		// A tool needed an answer nobody can give, so the step fails like an exec step would
+		if tc.stopErr != nil {
+			transcript.finish(AgentFailed, lastTextBlock)
+			return lastTextBlock, tc.stopErr
 		}
 
-		// If stop reason is end_turn without tool use, we're done
-		if response.StopReason == "end_turn" && len(toolResults) == 0 {
-			fmt.Printf("\n\033[33m⚠ Agent finished without calling complete tool\033[0m\n")
+		if completed {
+			transcript.finish(AgentCompleted, finalOutput)
+			return finalOutput, nil
+		}
+
+		// If the model stopped without using tools, we're done
+		if len(toolResults) == 0 {
+			transcript.finish(AgentStopped, lastTextBlock)
+			fmt.Print("\n" + ansiYellow + "⚠ Agent finished without calling complete tool" + ansiReset + "\n")
 			return lastTextBlock, nil
 		}
+
+		transcript.save()
 	}
 
 	// Max iterations reached without completion
-	fmt.Printf("\n\033[33m⚠ Agent reached max iterations (%d) without completing\033[0m\n", maxIterations)
+	transcript.finish(AgentMaxIterations, lastTextBlock)
+	fmt.Printf("\n"+ansiYellow+"⚠ Agent reached max iterations (%d) without completing"+ansiReset+"\n", maxIterations)
+	transcript.printResumeHint()
 	return lastTextBlock, nil
 }
 
 // runSubcommandStep executes another command as a step
-func runSubcommandStep(client anthropic.Client, authType AuthType, config *CommandsConfig, ctx *PipelineContext, step *SubcommandStep) (string, error) {
+func runSubcommandStep(providers *Providers, config *CommandsConfig, ctx *PipelineContext, step *SubcommandStep) (string, error) {
 	// Look up the command
 	cmd, ok := config.Commands[step.Name]
 	if !ok {
@@ -496,17 +675,17 @@ func runSubcommandStep(client anthropic.Client, authType AuthType, config *Comma
 
 	debugLog("Calling command: %s with args: %v", step.Name, args)
 
-	if isDryRun() {
+	if ctx.Options.DryRun {
 		fmt.Printf("[DRYRUN] Would call command: %s %v\n", step.Name, args)
 		return "[dry run - no command execution]", nil
 	}
 
 	if !step.Silent {
-		fmt.Printf("\n\033[1;35m❯ Running command:\033[0m %s %s\n", step.Name, strings.Join(args, " "))
+		fmt.Printf("\n"+ansiBoldMagenta+"❯ Running command:"+ansiReset+" %s %s\n", displayName(step.Name), strings.Join(args, " "))
 	}
 
 	// Run the command pipeline
-	output, err := RunPipeline(client, authType, config, cmd, args, true)
+	output, err := RunPipeline(providers, config, cmd, args, ctx.Options, true)
 	if err != nil {
 		return "", fmt.Errorf("command %s failed: %w", step.Name, err)
 	}
@@ -515,7 +694,7 @@ func runSubcommandStep(client anthropic.Client, authType AuthType, config *Comma
 }
 
 // handleShellTool processes a shell tool call
-func handleShellTool(input json.RawMessage, autoExecute bool) (string, bool) {
+func handleShellTool(tc *toolContext, input json.RawMessage) (string, bool) {
 	var params struct {
 		Command string `json:"command"`
 	}
@@ -523,23 +702,45 @@ func handleShellTool(input json.RawMessage, autoExecute bool) (string, bool) {
 		return fmt.Sprintf("Error parsing tool input: %v", err), true
 	}
 
-	if !autoExecute {
-		printCommandForConfirm(params.Command)
-		fmt.Print("Run this command? [Y/n]: ")
+	command := params.Command
+	if err := tc.checkCommand(command); err != nil {
+		fmt.Printf("\n"+ansiYellow+"✗ Blocked:"+ansiReset+" %s\n", command)
+		return fmt.Sprintf("Command rejected: %v. Do not retry it; use an allowed command or another tool.", err), true
+	}
+
+	activeTest.recordExec(command, !tc.autoExecute)
 
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
-		response = strings.TrimSpace(strings.ToLower(response))
+	if !tc.autoExecute {
+		review := newCommandReview(tc.providers, command, "", "", "")
+		review.CanRefine = true
 
-		if response != "" && response != "y" && response != "yes" {
+		outcome, feedback := review.Prompt()
+		switch outcome {
+		case reviewCancel:
+			if review.Err != nil {
+				tc.stopErr = review.Err
+				return fmt.Sprintf("Error: %v", review.Err), true
+			}
 			return "Command execution cancelled by user.", false
+		case reviewRefine:
+			// Send the feedback to the agent instead of running the command
+			return fmt.Sprintf("The user did not run this command and gave this feedback instead: %s", feedback), false
 		}
-		fmt.Println()
+		command = review.Command
 	} else {
-		printExecCommand(params.Command)
+		printExecCommand(command)
 	}
 
-	output, err := RunShellCommandWithOutput(params.Command)
+	output, mocked, err := activeTest.mockedExec(command)
+	if !mocked {
+		output, err = RunShellCommandWithOutput(command)
+		activeRun.recordExec(command, !tc.autoExecute, err)
+		activeEvents.execFinished(command, err)
+	}
+	if command != params.Command {
+		// Tell the agent what actually ran
+		output = fmt.Sprintf("(The user edited the command before running it: %s)\n%s", command, output)
+	}
 	if err != nil {
 		return fmt.Sprintf("Error: %v\nOutput: %s", err, output), true
 	}
@@ -559,11 +760,11 @@ func extractOutput(input json.RawMessage) string {
 }
 
 // trackUsage tracks token usage from a response
-func trackUsage(usage anthropic.Usage) {
+func trackUsage(usage TokenUsage) {
 	if usage.InputTokens > 0 || usage.OutputTokens > 0 {
 		usageData, err := LoadUsage()
 		if err == nil {
-			usageData.Add(usage.InputTokens, usage.OutputTokens, 0, usage.CacheCreationInputTokens, usage.CacheReadInputTokens)
+			usageData.Add(usage.InputTokens, usage.OutputTokens, 0, usage.CacheCreationTokens, usage.CacheReadTokens)
 			usageData.Save()
 		}
 	}
@@ -703,7 +904,10 @@ func stripMarkdownCodeBlock(s string) string {
 
 // printExecCommand prints the command being executed in a formatted way
 func printExecCommand(command string) {
-	fmt.Printf("\n\033[1;34m❯ Executing:\033[0m %s\n", command)
+	if quietMode {
+		return
+	}
+	fmt.Printf("\n"+ansiBoldBlue+"❯ Executing:"+ansiReset+" %s\n", command)
 }
 
 // printCommandForConfirm renders a command as a code block for confirmation prompts
@@ -714,6 +918,11 @@ func printCommandForConfirm(command string) {
 
 // renderMarkdown renders text as markdown to the terminal
 func renderMarkdown(text string) {
+	fmt.Print(renderMarkdownString(text))
+}
+
+// renderMarkdownString renders text as markdown and returns the terminal output
+func renderMarkdownString(text string) string {
 	width := 80
 	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
 		width = w
@@ -724,16 +933,16 @@ func renderMarkdown(text string) {
 		glamour.WithWordWrap(width),
 	)
 	if err != nil {
-		fmt.Println(text)
-		return
+		return text + "\n"
 	}
 
 	rendered, err := renderer.Render(text)
 	if err != nil {
-		fmt.Println(text)
-		return
+		return text + "\n"
+	}
+	if noColor {
+		rendered = stripAnsi(rendered)
 	}
 
-	rendered = addCodeBlockBorder(rendered)
-	fmt.Print(rendered)
+	return addCodeBlockBorder(rendered)
 }
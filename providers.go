@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Message roles
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Content block types
+const (
+	BlockText       = "text"
+	BlockToolUse    = "tool_use"
+	BlockToolResult = "tool_result"
+)
+
+// Normalized stop reasons
+const (
+	StopEndTurn   = "end_turn"
+	StopToolUse   = "tool_use"
+	StopMaxTokens = "max_tokens"
+)
+
+// ContentBlock is a provider-neutral piece of message content
+type ContentBlock struct {
+	Type     string          `json:"type"`                // text, tool_use or tool_result
+	Text     string          `json:"text,omitempty"`      // Text, or tool result content
+	ToolID   string          `json:"tool_id,omitempty"`   // Tool call ID (tool_use and tool_result)
+	ToolName string          `json:"tool_name,omitempty"` // Tool name (tool_use, and tool_result for providers that need it)
+	Input    json.RawMessage `json:"input,omitempty"`     // Tool call arguments (tool_use)
+	IsError  bool            `json:"is_error,omitempty"`  // Tool result is an error (tool_result)
+}
+
+// Message is a provider-neutral conversation message
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// ToolDef describes a tool the model can call
+type ToolDef struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Properties  map[string]any `json:"properties,omitempty"` // JSON schema properties of the input object
+	Required    []string       `json:"required,omitempty"`
+}
+
+// CompletionRequest is a provider-neutral model request
+type CompletionRequest struct {
+	Model       string    `json:"model,omitempty"` // Empty uses the provider's default model
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+	Tools       []ToolDef `json:"tools,omitempty"`
+	MaxTokens   int64     `json:"max_tokens,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+}
+
+// TokenUsage reports tokens used by a request
+type TokenUsage struct {
+	InputTokens         int64 `json:"input_tokens"`
+	OutputTokens        int64 `json:"output_tokens"`
+	CacheCreationTokens int64 `json:"cache_creation_tokens,omitempty"`
+	CacheReadTokens     int64 `json:"cache_read_tokens,omitempty"`
+}
+
+// CompletionResponse is a provider-neutral model response
+type CompletionResponse struct {
+	Content    []ContentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      TokenUsage     `json:"usage"`
+}
+
+// Provider is an LLM backend that supports streaming completions with tool use
+type Provider interface {
+	// Name returns the provider type (e.g. "anthropic", "openai")
+	Name() string
+	// DefaultModel returns the model used when a request doesn't specify one
+	DefaultModel() string
+	// Complete sends a request, passing streamed text to onText (if non-nil).
+	// On error, any partial response received so far is returned.
+	Complete(ctx context.Context, req CompletionRequest, onText func(string)) (*CompletionResponse, error)
+}
+
+// NewTextMessage creates a message with a single text block
+func NewTextMessage(role, text string) Message {
+	return Message{Role: role, Content: []ContentBlock{{Type: BlockText, Text: text}}}
+}
+
+// NewToolResult creates a tool result block for a tool call
+func NewToolResult(call ContentBlock, result string, isError bool) ContentBlock {
+	return ContentBlock{Type: BlockToolResult, ToolID: call.ToolID, ToolName: call.ToolName, Text: result, IsError: isError}
+}
+
+// Text returns the concatenated text blocks of the response
+func (r *CompletionResponse) Text() string {
+	var text strings.Builder
+	for _, block := range r.Content {
+		if block.Type == BlockText {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String()
+}
+
+// complete sends a request to a provider and tracks token usage.
+// If ctx is cancelled, the partial response is returned with ErrInterrupted.
+func complete(ctx context.Context, provider Provider, req CompletionRequest, onText func(string)) (*CompletionResponse, error) {
+	if activeEvents != nil {
+		show := onText
+		onText = func(text string) {
+			activeEvents.llmText(text)
+			if show != nil {
+				show(text)
+			}
+		}
+	}
+	resp, err := provider.Complete(ctx, req, onText)
+	if resp == nil {
+		resp = &CompletionResponse{}
+	}
+
+	// Track usage even for interrupted responses
+	trackUsage(resp.Usage)
+	activeRun.addUsage(resp.Usage)
+	activeEvents.addUsage(resp.Usage)
+
+	if ctx.Err() != nil {
+		return resp, ErrInterrupted
+	}
+	if err != nil {
+		return resp, &LLMError{Provider: provider.Name(), StatusCode: statusCode(err), Err: err}
+	}
+	return resp, nil
+}
+
+// statusCode returns the HTTP status of a failed provider request, or 0
+func statusCode(err error) int {
+	var apiErr *anthropic.Error
+	var httpErr *statusError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.StatusCode
+	case errors.As(err, &httpErr):
+		return httpErr.StatusCode
+	default:
+		return 0
+	}
+}
+
+// NewProvider creates a provider from its configuration
+func NewProvider(ctx context.Context, pc ProviderConfig) (Provider, error) {
+	switch pc.AuthType {
+	case AuthTypeAPIKey, AuthTypeVertex:
+		return NewAnthropicProvider(ctx, pc)
+	case AuthTypeOpenAI:
+		return NewOpenAIProvider(pc), nil
+	case AuthTypeOllama:
+		return NewOllamaProvider(pc), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAuthType, pc.AuthType)
+	}
+}
+
+// Providers resolves providers by name, creating them on first use.
+// The empty name (or "default") is the main configured provider; other names
+// refer to entries in Config.Providers or to a provider type (e.g. "ollama")
+// which is then used with its default settings.
+type Providers struct {
+	config    *Config
+	configErr error
+	cache     map[string]Provider
+	script    *scriptedScript // Scripted responses (X_FAKE_LLM or a command test)
+	replay    *fixtureStore   // Recorded responses to serve (X_REPLAY or a command test)
+	record    *fixtureStore   // Where to record responses (X_RECORD)
+	model     string          // Model for every provider, overriding steps and config (--model)
+	envLoaded bool
+}
+
+// NewProviders creates a provider registry. A nil config (with its load error)
+// is allowed so that commands without LLM steps work before 'x configure'.
+func NewProviders(config *Config, configErr error) *Providers {
+	return &Providers{
+		config:    config,
+		configErr: configErr,
+		cache:     make(map[string]Provider),
+	}
+}
+
+// Get returns the named provider, optionally overriding its model
+func (p *Providers) Get(name, model string) (Provider, error) {
+	if name == "default" {
+		name = ""
+	}
+	if p.model != "" {
+		model = p.model
+	}
+
+	key := name + "\x00" + model
+	if provider, ok := p.cache[key]; ok {
+		return provider, nil
+	}
+
+	pc, err := p.providerConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	if model != "" {
+		pc.Model = model
+	}
+
+	provider, err := NewProvider(context.Background(), pc)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cache[key] = provider
+	return provider, nil
+}
+
+// ForStep returns the provider for a pipeline step. step identifies the step
+// (command name and step id) for record/replay and scripted responses.
+// With scripted or replayed responses, no real provider is created, so
+// pipelines can run offline without 'x configure'.
+func (p *Providers) ForStep(step, name, model string) (Provider, error) {
+	if err := p.loadTestingEnv(); err != nil {
+		return nil, err
+	}
+
+	if p.script != nil {
+		return &ScriptedProvider{script: p.script, step: step}, nil
+	}
+	if p.replay != nil {
+		return &ReplayProvider{store: p.replay, step: step}, nil
+	}
+
+	provider, err := p.Get(name, model)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.record != nil {
+		return &RecordingProvider{Provider: provider, store: p.record, step: step}, nil
+	}
+
+	return provider, nil
+}
+
+// loadTestingEnv sets up scripted, replayed or recorded responses from
+// X_FAKE_LLM, X_REPLAY and X_RECORD, unless already set (e.g. by a command test)
+func (p *Providers) loadTestingEnv() error {
+	if p.envLoaded {
+		return nil
+	}
+
+	if path := os.Getenv(EnvFake); path != "" && p.script == nil {
+		script, err := loadScript(path)
+		if err != nil {
+			return err
+		}
+		p.script = script
+	}
+	if dir := os.Getenv(EnvReplay); dir != "" && p.replay == nil {
+		p.replay = newFixtureStore(dir)
+		p.replay.bySeq = os.Getenv(EnvReplayBySeq) != ""
+	}
+	if dir := os.Getenv(EnvRecord); dir != "" && p.record == nil {
+		p.record = newFixtureStore(dir)
+	}
+
+	p.envLoaded = true
+	return nil
+}
+
+// providerConfig looks up the configuration for a provider name
+func (p *Providers) providerConfig(name string) (ProviderConfig, error) {
+	if p.config != nil {
+		if name == "" {
+			return p.config.ProviderConfig, nil
+		}
+		if pc, ok := p.config.Providers[name]; ok {
+			return pc, nil
+		}
+	}
+
+	// Provider types that work without credentials can be used by name directly
+	switch AuthType(name) {
+	case AuthTypeOllama, AuthTypeOpenAI:
+		return ProviderConfig{AuthType: AuthType(name)}, nil
+	}
+
+	if p.config == nil {
+		return ProviderConfig{}, fmt.Errorf("%w: %v", ErrNotConfigured, p.configErr)
+	}
+	return ProviderConfig{}, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+}
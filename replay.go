@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// fixture is a recorded LLM request and its response
+type fixture struct {
+	Step     string             `json:"step"` // Command name and step id, e.g. "shell.generate"
+	Seq      int                `json:"seq"`  // Call number for this step within the run (agentic steps make several)
+	Hash     string             `json:"hash"` // Hash of the request's prompts, messages and tools
+	Request  CompletionRequest  `json:"request"`
+	Response CompletionResponse `json:"response"`
+}
+
+// fixtureStore reads and writes fixtures in a directory, one file per call
+type fixtureStore struct {
+	dir    string
+	bySeq  bool // Fall back to the same call number when a request changed
+	mu     sync.Mutex
+	seq    map[string]int        // Step -> calls made so far in this run
+	loaded map[string][]*fixture // Step -> fixtures on disk (nil until first lookup)
+}
+
+// newFixtureStore creates a store for a fixtures directory
+func newFixtureStore(dir string) *fixtureStore {
+	return &fixtureStore{dir: dir, seq: make(map[string]int)}
+}
+
+// next returns the next call number for a step
+func (s *fixtureStore) next(step string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq[step]++
+	return s.seq[step]
+}
+
+// save writes a fixture to the directory
+func (s *fixtureStore) save(f *fixture) error {
+	if err := os.MkdirAll(s.dir, DirPerms); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%03d.json", fixtureFileName(f.Step), f.Seq)
+	return os.WriteFile(filepath.Join(s.dir, name), data, CommandsPerms)
+}
+
+// find returns the fixture for a call with the same request hash. If the
+// request changed since recording, it fails unless sequence matching is on
+// (for prompts that contain the time or directory), in which case the fixture
+// recorded for the same call number is used.
+func (s *fixtureStore) find(step, hash string, seq int) (*fixture, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loaded == nil {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	var byHash, bySeq *fixture
+	for _, f := range s.loaded[step] {
+		if f.Hash == hash && (byHash == nil || f.Seq == seq) {
+			byHash = f
+		}
+		if f.Seq == seq {
+			bySeq = f
+		}
+	}
+
+	if byHash != nil {
+		return byHash, nil
+	}
+	if bySeq != nil {
+		if !s.bySeq {
+			return nil, fmt.Errorf("%w for step %s (call %d) in %s: the request changed since recording; re-record it with %s=%s, or set %s=1 to match by call number",
+				ErrFixtureNotFound, step, seq, s.dir, EnvRecord, s.dir, EnvReplayBySeq)
+		}
+		debugLog("Replay: request for %s call %d changed since recording; using recorded call", step, seq)
+		return bySeq, nil
+	}
+
+	return nil, fmt.Errorf("%w for step %s (call %d) in %s; record it with %s=%s",
+		ErrFixtureNotFound, step, seq, s.dir, EnvRecord, s.dir)
+}
+
+// load reads all fixtures in the directory
+func (s *fixtureStore) load() error {
+	s.loaded = make(map[string][]*fixture)
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var f fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("invalid fixture %s: %w", path, err)
+		}
+		s.loaded[f.Step] = append(s.loaded[f.Step], &f)
+	}
+
+	return nil
+}
+
+// unsafeFileChars matches characters not allowed in fixture file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fixtureFileName turns a step name into a file name prefix
+func fixtureFileName(step string) string {
+	return unsafeFileChars.ReplaceAllString(step, "_")
+}
+
+// requestHash hashes the parts of a request that determine the response.
+// The model and sampling settings are left out so fixtures survive model changes.
+func requestHash(req CompletionRequest) string {
+	toolNames := make([]string, 0, len(req.Tools))
+	for _, tool := range req.Tools {
+		toolNames = append(toolNames, tool.Name)
+	}
+
+	data, _ := json.Marshal(struct {
+		System   string    `json:"system"`
+		Messages []Message `json:"messages"`
+		Tools    []string  `json:"tools"`
+	}{req.System, req.Messages, toolNames})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordingProvider passes requests to a real provider and saves each
+// request and response as a fixture (X_RECORD)
+type RecordingProvider struct {
+	Provider
+	store *fixtureStore
+	step  string
+}
+
+// Complete calls the wrapped provider and records the exchange
+func (p *RecordingProvider) Complete(ctx context.Context, req CompletionRequest, onText func(string)) (*CompletionResponse, error) {
+	seq := p.store.next(p.step)
+
+	resp, err := p.Provider.Complete(ctx, req, onText)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	f := &fixture{Step: p.step, Seq: seq, Hash: requestHash(req), Request: req, Response: *resp}
+	if err := p.store.save(f); err != nil {
+		return resp, fmt.Errorf("failed to save fixture: %w", err)
+	}
+	debugLog("Recorded %s call %d", p.step, seq)
+
+	return resp, nil
+}
+
+// ReplayProvider serves responses from recorded fixtures (X_REPLAY)
+type ReplayProvider struct {
+	store *fixtureStore
+	step  string
+}
+
+// Name returns the provider type
+func (p *ReplayProvider) Name() string {
+	return "replay"
+}
+
+// DefaultModel returns an empty model; fixtures are matched regardless of model
+func (p *ReplayProvider) DefaultModel() string {
+	return ""
+}
+
+// Complete returns the recorded response for the request
+func (p *ReplayProvider) Complete(ctx context.Context, req CompletionRequest, onText func(string)) (*CompletionResponse, error) {
+	seq := p.store.next(p.step)
+
+	f, err := p.store.find(p.step, requestHash(req), seq)
+	if err != nil {
+		return nil, err
+	}
+	debugLog("Replaying %s call %d", p.step, f.Seq)
+
+	// Replayed responses cost nothing, so don't report recorded usage
+	resp := &CompletionResponse{Content: f.Response.Content, StopReason: f.Response.StopReason}
+	if onText != nil {
+		if text := resp.Text(); text != "" {
+			onText(text)
+		}
+	}
+
+	return resp, ctx.Err()
+}
+
+// stepMatches reports whether a step pattern from a script or test file
+// matches a step name. The pattern is a full step name ("shell.generate"),
+// a step id ("generate") or a command name ("shell"); empty matches every step.
+func stepMatches(pattern, step string) bool {
+	return pattern == "" || pattern == step ||
+		strings.HasSuffix(step, "."+pattern) || strings.HasPrefix(step, pattern+".")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequestHash(t *testing.T) {
+	temperature := 0.2
+	base := CompletionRequest{
+		System:   "be brief",
+		Messages: []Message{NewTextMessage(RoleUser, "list files")},
+		Tools:    []ToolDef{{Name: ToolShell}},
+	}
+
+	tests := []struct {
+		name   string
+		change func(*CompletionRequest)
+		same   bool
+	}{
+		{"model", func(r *CompletionRequest) { r.Model = "other-model" }, true},
+		{"sampling", func(r *CompletionRequest) { r.MaxTokens = 10; r.Temperature = &temperature }, true},
+		{"tool description", func(r *CompletionRequest) { r.Tools[0].Description = "runs commands" }, true},
+		{"system prompt", func(r *CompletionRequest) { r.System = "be verbose" }, false},
+		{"message", func(r *CompletionRequest) { r.Messages = []Message{NewTextMessage(RoleUser, "list dirs")} }, false},
+		{"tools", func(r *CompletionRequest) { r.Tools = append(r.Tools, ToolDef{Name: ToolReadFile}) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base
+			req.Tools = append([]ToolDef(nil), base.Tools...)
+			tt.change(&req)
+			if same := requestHash(req) == requestHash(base); same != tt.same {
+				t.Errorf("hash unchanged = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestFixtureStoreFind(t *testing.T) {
+	fixtures := []*fixture{
+		{Step: "ask.generate", Seq: 1, Hash: "a"},
+		{Step: "ask.generate", Seq: 2, Hash: "b"},
+		{Step: "ask.generate", Seq: 3, Hash: "a"},
+	}
+
+	tests := []struct {
+		name    string
+		step    string
+		hash    string
+		seq     int
+		bySeq   bool
+		wantSeq int // 0 for not found
+	}{
+		{"same hash and call", "ask.generate", "b", 2, false, 2},
+		{"same hash, other call", "ask.generate", "b", 5, false, 2},
+		{"repeated hash prefers the call", "ask.generate", "a", 3, false, 3},
+		{"repeated hash, other call uses the first", "ask.generate", "a", 2, false, 1},
+		{"changed request", "ask.generate", "c", 1, false, 0},
+		{"changed request by call number", "ask.generate", "c", 1, true, 1},
+		{"no call to fall back to", "ask.generate", "c", 4, true, 0},
+		{"unknown step", "ask.other", "a", 1, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFixtureStore(t.TempDir())
+			store.bySeq = tt.bySeq
+			store.loaded = map[string][]*fixture{"ask.generate": fixtures}
+
+			f, err := store.find(tt.step, tt.hash, tt.seq)
+			if tt.wantSeq == 0 {
+				if !errors.Is(err, ErrFixtureNotFound) {
+					t.Errorf("err = %v, want ErrFixtureNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("find() error: %v", err)
+			}
+			if f.Seq != tt.wantSeq {
+				t.Errorf("found call %d, want %d", f.Seq, tt.wantSeq)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Risk levels, from least to most dangerous
+var riskLevels = []string{"none", "low", "medium", "high"}
+
+// RiskRule flags commands matching a pattern with a risk level. Teams can add
+// their own under risk_rules in a commands config, or replace a built-in rule
+// by using its name.
+type RiskRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"` // Regular expression matched against the command
+	Risk    string `yaml:"risk"`    // none, low, medium or high
+	Reason  string `yaml:"reason"`  // Shown when the rule fires
+
+	re *regexp.Regexp
+}
+
+// riskMatch is a rule that fired for a command
+type riskMatch struct {
+	Rule   string
+	Risk   string
+	Reason string
+}
+
+// builtinRiskRules cover common destructive commands in bash, PowerShell and
+// cmd. They're compiled once, when x starts.
+var builtinRiskRules = mustCompileRiskRules([]RiskRule{
+	{Name: "rm-recursive-force", Risk: "high", Reason: "deletes files recursively without asking",
+		Pattern: `\brm\s+(\S+\s+)*-[a-zA-Z]*([rR][a-zA-Z]*f|f[a-zA-Z]*[rR])|\brm\s+.*(-[rR]\b|--recursive).*(-f\b|--force)|\brm\s+.*(-f\b|--force).*(-[rR]\b|--recursive)`},
+	{Name: "rm-recursive", Risk: "medium", Reason: "deletes files recursively",
+		Pattern: `\brm\s+(\S+\s+)*(-[a-zA-Z]*[rR]|--recursive)\b`},
+	{Name: "remove-item-recurse", Risk: "high", Reason: "deletes files recursively",
+		Pattern: `(?i)(^|[;&|]\s*)(Remove-Item|ri|rd|rmdir|del)\s(.*\s)?(-Recurse|/s)\b`},
+	{Name: "dd-device", Risk: "high", Reason: "writes directly to a device",
+		Pattern: `\bdd\b.*\bof=/dev/`},
+	{Name: "write-device", Risk: "high", Reason: "writes directly to a disk device",
+		Pattern: `>\s*/dev/(sd|hd|nvme|disk|mmcblk)`},
+	{Name: "mkfs", Risk: "high", Reason: "formats a filesystem",
+		Pattern: `\bmkfs(\.\w+)?\b|(?i)\b(Format-Volume|Clear-Disk|Initialize-Disk)\b|(?i)^\s*format\s+[a-z]:`},
+	{Name: "partition", Risk: "high", Reason: "changes disk partitions",
+		Pattern: `\b(fdisk|sfdisk|parted|wipefs)\b|(?i)\bdiskpart\b`},
+	{Name: "chmod-777-recursive", Risk: "high", Reason: "makes files writable by everyone, recursively",
+		Pattern: `\bchmod\b.*-[a-zA-Z]*R.*\b777\b|\bchmod\b.*\b777\b.*-[a-zA-Z]*R`},
+	{Name: "chown-recursive-root", Risk: "high", Reason: "changes ownership of system directories",
+		Pattern: `\bchown\b.*-[a-zA-Z]*R.*\s/(\s|$|etc|usr|var|bin|lib)`},
+	{Name: "git-force-push", Risk: "high", Reason: "overwrites remote history",
+		Pattern: `\bgit\s+push\b.*(\s--force(\s|$)|\s-[a-zA-Z]*f\b|\s\+\S)`},
+	{Name: "git-force-with-lease", Risk: "medium", Reason: "rewrites remote history",
+		Pattern: `\bgit\s+push\b.*\s--force-with-lease\b`},
+	{Name: "git-discard", Risk: "medium", Reason: "discards uncommitted changes",
+		Pattern: `\bgit\s+(reset\s+.*--hard|clean\s+.*-[a-zA-Z]*f|checkout\s+(--\s+)?\.(\s|$)|restore\s+\.)`},
+	{Name: "pipe-to-shell", Risk: "high", Reason: "runs a script downloaded from the internet",
+		Pattern: `(?i)\b(curl|wget|fetch|iwr|irm|Invoke-WebRequest|Invoke-RestMethod)\b[^|]*\|\s*(sudo\s+)?(\S*/)?(ba|z|k|da|fi)?sh\b|(?i)\b(curl|wget|iwr|irm|Invoke-WebRequest|Invoke-RestMethod)\b.*\|\s*(iex|Invoke-Expression)\b|(?i)\b(ba|z)?sh\s+<\(\s*(curl|wget)`},
+	{Name: "sql-drop", Risk: "high", Reason: "drops or empties database objects",
+		Pattern: `(?i)\b(drop\s+(table|database|schema|index|view)|truncate\s+(table\s+)?\w)`},
+	{Name: "sql-delete-all", Risk: "high", Reason: "deletes every row of a table",
+		Pattern: `(?i)\bdelete\s+from\s+[\w."]+\s*(;|"|'|$)`},
+	{Name: "sudo", Risk: "medium", Reason: "runs as root",
+		Pattern: `(^|[;&|(]\s*)(sudo|doas)\s|(?i)-Verb\s+RunAs\b`},
+	{Name: "kill-force", Risk: "medium", Reason: "kills processes without letting them clean up",
+		Pattern: `\bkill\s+-(9|KILL|SIGKILL)\b|\b(killall|pkill)\b|(?i)\bStop-Process\b.*-Force\b|(?i)\btaskkill\b.*/f\b`},
+	{Name: "shutdown", Risk: "high", Reason: "shuts down or restarts the machine",
+		Pattern: `(^|[;&|]\s*|sudo\s+)(shutdown|reboot|halt|poweroff)\b|(?i)\b(Stop-Computer|Restart-Computer)\b`},
+	{Name: "fork-bomb", Risk: "high", Reason: "a fork bomb",
+		Pattern: `:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}`},
+	{Name: "execution-policy", Risk: "medium", Reason: "lowers the PowerShell execution policy",
+		Pattern: `(?i)\bSet-ExecutionPolicy\b.*\b(Unrestricted|Bypass)\b`},
+	{Name: "overwrite-system-file", Risk: "high", Reason: "overwrites a system file",
+		Pattern: `>\s*/(etc|boot|usr|bin|sbin|lib)/`},
+})
+
+// customRiskRules are the risk_rules from the commands config, compiled and
+// set when it's loaded
+var customRiskRules []RiskRule
+
+// compile checks the rule and compiles its pattern
+func (r *RiskRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("risk rule needs a name")
+	}
+	if riskLevel(r.Risk) < 0 {
+		return fmt.Errorf("risk rule %s: risk must be none, low, medium or high", r.Name)
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("risk rule %s: %w", r.Name, err)
+	}
+	r.re = re
+	return nil
+}
+
+// mustCompileRiskRules compiles rules, panicking if one is invalid
+func mustCompileRiskRules(rules []RiskRule) []RiskRule {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			panic(err)
+		}
+	}
+	return rules
+}
+
+// activeRiskRules returns the built-in rules, replaced or extended by custom rules
+func activeRiskRules() []RiskRule {
+	rules := make([]RiskRule, 0, len(builtinRiskRules)+len(customRiskRules))
+	for _, rule := range builtinRiskRules {
+		overridden := false
+		for _, custom := range customRiskRules {
+			if custom.Name == rule.Name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			rules = append(rules, rule)
+		}
+	}
+	return append(rules, customRiskRules...)
+}
+
+// classifyCommand returns the rules a command triggers, most dangerous first
+func classifyCommand(command string) []riskMatch {
+	var matches []riskMatch
+	for _, rule := range activeRiskRules() {
+		if riskLevel(rule.Risk) > 0 && rule.re.MatchString(command) {
+			matches = append(matches, riskMatch{Rule: rule.Name, Risk: rule.Risk, Reason: rule.Reason})
+		}
+	}
+
+	if path := writeOutsideDirectory(command); path != "" {
+		matches = append(matches, riskMatch{Rule: "write-outside-directory", Risk: "medium", Reason: "changes " + path + ", outside the current directory"})
+	}
+
+	// Most dangerous first, keeping rule order within a level
+	for i := 1; i < len(matches); i++ {
+		for j := i; j > 0 && riskLevel(matches[j].Risk) > riskLevel(matches[j-1].Risk); j-- {
+			matches[j], matches[j-1] = matches[j-1], matches[j]
+		}
+	}
+	return matches
+}
+
+// riskLevel returns the index of a risk string's level ("high - reason" is
+// high), or -1 if it doesn't start with one
+func riskLevel(risk string) int {
+	risk = strings.ToLower(strings.TrimSpace(risk))
+	for i := len(riskLevels) - 1; i >= 0; i-- {
+		if strings.HasPrefix(risk, riskLevels[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// combineRisk returns the higher of the LLM's risk and the rules' risk.
+// The LLM's wording is kept unless the rules rate the command higher.
+func combineRisk(risk string, matches []riskMatch) string {
+	if len(matches) == 0 || riskLevel(matches[0].Risk) <= riskLevel(risk) {
+		return risk
+	}
+	return matches[0].Risk + " - " + matches[0].Reason
+}
+
+// printRiskRules lists the rules that fired, for risky commands
+func printRiskRules(risk string, matches []riskMatch) {
+	if !isRiskyCommand(risk) {
+		return
+	}
+	for _, m := range matches {
+		if riskLevel(m.Risk) >= riskLevel("medium") {
+			fmt.Printf(ansiDim+"⚑ %s: %s (%s)"+ansiReset+"\n", m.Rule, m.Reason, m.Risk)
+		}
+	}
+}
+
+// writeOutsideDirectory returns a path outside the current directory that
+// the command deletes, moves, writes or redirects to, or ""
+func writeOutsideDirectory(command string) string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	home, _ := os.UserHomeDir()
+
+	for _, seg := range splitCommandSegments(command) {
+		words := seg.Words
+		if len(words) > 0 && (words[0] == "sudo" || words[0] == "doas") {
+			words = words[1:]
+		}
+
+		var targets []string
+		for i, word := range words {
+			// Redirections: > file, >>file, 2> file
+			if j := strings.Index(word, ">"); j >= 0 && !strings.Contains(word, ">&") {
+				if target := strings.TrimLeft(word[j:], ">|"); target != "" {
+					targets = append(targets, target)
+				} else if i+1 < len(words) {
+					targets = append(targets, words[i+1])
+				}
+			}
+		}
+		if len(words) > 1 {
+			operands := nonFlagWords(words[1:])
+			switch words[0] {
+			case "rm", "rmdir", "touch", "mkdir", "tee", "truncate", "shred", "chmod", "chown":
+				targets = append(targets, operands...)
+			case "mv", "cp", "ln", "install", "rsync":
+				if len(operands) > 0 {
+					targets = append(targets, operands[len(operands)-1])
+				}
+				if words[0] == "mv" {
+					targets = append(targets, operands...)
+				}
+			}
+		}
+
+		for _, target := range targets {
+			if outsideDirectory(target, cwd, home) {
+				return target
+			}
+		}
+	}
+	return ""
+}
+
+// nonFlagWords returns the words that aren't flags
+func nonFlagWords(words []string) []string {
+	var result []string
+	for _, word := range words {
+		if !strings.HasPrefix(word, "-") {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// outsideDirectory reports whether path is outside dir. A relative path that
+// climbs out of dir is always outside; absolute temporary files and
+// /dev/null-like devices don't count. Paths with variables other than $HOME,
+// or with command substitution, can't be resolved and count as outside.
+func outsideDirectory(path, dir, home string) bool {
+	if path == "" {
+		return false
+	}
+	path, ok := expandHome(path, home)
+	if !ok {
+		return true
+	}
+	if !filepath.IsAbs(path) {
+		return escapesDirectory(filepath.Join(dir, path), dir)
+	}
+	path = filepath.Clean(path)
+	if !escapesDirectory(path, dir) {
+		return false
+	}
+
+	for _, safe := range []string{os.TempDir(), "/tmp", "/dev/null", "/dev/stdout", "/dev/stderr"} {
+		if path == safe || strings.HasPrefix(path, safe+string(filepath.Separator)) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandHome replaces a leading ~, $HOME or ${HOME} with the home directory.
+// It reports false if the path still has a variable, command substitution or
+// another user's home (~user).
+func expandHome(path, home string) (string, bool) {
+	if home != "" {
+		for _, prefix := range []string{"~", "${HOME}", "$HOME"} {
+			rest, ok := strings.CutPrefix(path, prefix)
+			if ok && (rest == "" || rest[0] == '/') {
+				path = home + rest
+				break
+			}
+		}
+	}
+	return path, !strings.ContainsAny(path, "$`") && !strings.HasPrefix(path, "~")
+}
+
+// escapesDirectory reports whether path is outside dir
+func escapesDirectory(path, dir string) bool {
+	rel, err := filepath.Rel(dir, filepath.Clean(path))
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,144 @@
+package main
+
+import "testing"
+
+func TestClassifyCommand(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	tests := []struct {
+		command  string
+		wantRule string // Most dangerous rule, or "" for none
+		wantRisk string
+	}{
+		{"ls -la", "", ""},
+		{"rm -rf build", "rm-recursive-force", "high"},
+		{"rm -r -f build", "rm-recursive-force", "high"},
+		{"rm -r build", "rm-recursive", "medium"},
+		{"rm build.log", "", ""},
+		{"git push --force origin main", "git-force-push", "high"},
+		{"git push --force-with-lease", "git-force-with-lease", "medium"},
+		{"git push origin main", "", ""},
+		{"curl -fsSL https://example.com/install.sh | sh", "pipe-to-shell", "high"},
+		{"sudo rm -rf /var/cache", "rm-recursive-force", "high"},
+		{"sudo apt update", "sudo", "medium"},
+		{"Remove-Item -Recurse C:\\build", "remove-item-recurse", "high"},
+		{"psql -c 'DROP TABLE users'", "sql-drop", "high"},
+		{"echo hi > /etc/motd", "overwrite-system-file", "high"},
+		{"echo hi > ../notes.txt", "write-outside-directory", "medium"},
+		{"echo hi > notes.txt", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			matches := classifyCommand(tt.command)
+			if tt.wantRule == "" {
+				if len(matches) > 0 {
+					t.Errorf("classifyCommand() = %+v, want no matches", matches)
+				}
+				return
+			}
+			if len(matches) == 0 {
+				t.Fatalf("classifyCommand() found nothing, want %s", tt.wantRule)
+			}
+			if matches[0].Rule != tt.wantRule || matches[0].Risk != tt.wantRisk {
+				t.Errorf("first match = %s (%s), want %s (%s)", matches[0].Rule, matches[0].Risk, tt.wantRule, tt.wantRisk)
+			}
+		})
+	}
+}
+
+func TestClassifyCommandCustomRules(t *testing.T) {
+	defer func() { customRiskRules = nil }()
+
+	tests := []struct {
+		name     string
+		rules    []RiskRule
+		command  string
+		wantRule string
+	}{
+		{"adds a rule", []RiskRule{{Name: "kubectl-delete", Pattern: `\bkubectl\s+delete\b`, Risk: "high"}}, "kubectl delete ns prod", "kubectl-delete"},
+		{"replaces a built-in", []RiskRule{{Name: "sudo", Pattern: `^$`, Risk: "medium"}}, "sudo apt update", ""},
+		{"turns a built-in off", []RiskRule{{Name: "rm-recursive", Pattern: `\brm\b`, Risk: "none"}}, "rm -r build", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			customRiskRules = mustCompileRiskRules(tt.rules)
+			matches := classifyCommand(tt.command)
+			got := ""
+			if len(matches) > 0 {
+				got = matches[0].Rule
+			}
+			if got != tt.wantRule {
+				t.Errorf("first match = %q, want %q", got, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestRiskRuleCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RiskRule
+		wantErr bool
+	}{
+		{"valid", RiskRule{Name: "a", Pattern: `\bx\b`, Risk: "high"}, false},
+		{"no name", RiskRule{Pattern: `x`, Risk: "high"}, true},
+		{"unknown risk", RiskRule{Name: "a", Pattern: `x`, Risk: "severe"}, true},
+		{"bad pattern", RiskRule{Name: "a", Pattern: `(`, Risk: "high"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.compile()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteOutsideDirectory(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+	t.Chdir(t.TempDir()) // Under /tmp, so climbing out must not count as a temp file
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"echo hi > notes.txt", ""},
+		{"echo hi > ../notes.txt", "../notes.txt"},
+		{"echo hi >>../notes.txt", "../notes.txt"},
+		{"make 2> /var/log/build.log", "/var/log/build.log"},
+		{"make 2>&1", ""},
+		{"echo hi > /dev/null", ""},
+		{"echo hi > /tmp/out.txt", ""},
+		{"rm -f ~/.bashrc", "~/.bashrc"},
+		{"sudo rm /etc/hosts", "/etc/hosts"},
+		{"rm build/out.o", ""},
+		{"cp notes.txt ../backup/", "../backup/"},
+		{"cp /etc/hosts hosts", ""},
+		{"mv ../notes.txt notes.txt", "../notes.txt"},
+		{"ls && touch /opt/flag", "/opt/flag"},
+		{"rm $HOME/.bashrc", "$HOME/.bashrc"},
+		{"rm ${HOME}/.bashrc", "${HOME}/.bashrc"},
+		{"rm ~root/.bashrc", "~root/.bashrc"},
+		{"rm $OUT_DIR/app", "$OUT_DIR/app"},
+		{"echo hi > $(mktemp)", "$(mktemp)"},
+		{"touch ../../tmp-sibling", "../../tmp-sibling"},
+		{"cat /etc/hosts", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := writeOutsideDirectory(tt.command); got != tt.want {
+				t.Errorf("writeOutsideDirectory(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMustCompileRiskRulesPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("mustCompileRiskRules didn't panic on an invalid rule")
+		}
+	}()
+	mustCompileRiskRules([]RiskRule{{Name: "bad", Pattern: `(`, Risk: "high"}})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Run statuses
+const (
+	RunQueued      = "queued"
+	RunRunning     = "running"
+	RunSucceeded   = "succeeded"
+	RunFailed      = "failed"
+	RunCancelled   = "cancelled" // A confirm step was declined
+	RunInterrupted = "interrupted"
+)
+
+// runRecord is an entry in the run history: one top-level pipeline run,
+// including the steps of the commands it called
+type runRecord struct {
+	ID        string       `json:"id"`
+	Command   string       `json:"command"`
+	Args      []string     `json:"args"`
+	Source    string       `json:"source"`
+	Directory string       `json:"directory"`
+	Status    string       `json:"status"`
+	Error     string       `json:"error,omitempty"`
+	Resume    string       `json:"resume,omitempty"` // Transcript ID, for runs that resumed an agent
+	Started   time.Time    `json:"started"`
+	Duration  int64        `json:"duration_ms"`
+	Usage     TokenUsage   `json:"usage"`
+	Steps     []stepRecord `json:"steps"`
+
+	open []int // Indexes of steps that are running (nested subcommands)
+}
+
+// stepRecord is a step of a recorded run
+type stepRecord struct {
+	Name       string          `json:"name"` // e.g. deploy.build
+	Type       string          `json:"type"` // exec, llm, agentic or subcommand
+	Duration   int64           `json:"duration_ms"`
+	Error      string          `json:"error,omitempty"`
+	Transcript string          `json:"transcript,omitempty"` // Agent transcript ID (agentic steps)
+	Commands   []commandRecord `json:"commands,omitempty"`   // Shell commands it ran
+
+	started time.Time
+}
+
+// commandRecord is a shell command run by a step
+type commandRecord struct {
+	Command   string `json:"command"`
+	Confirmed bool   `json:"confirmed,omitempty"` // Approved at a confirm prompt
+	ExitCode  int    `json:"exit_code"`           // -1 if it couldn't be started
+}
+
+// activeRun is the run being recorded, or nil. Its methods are nil-safe
+// so pipelines can record unconditionally.
+var activeRun *runRecord
+
+// skipRunLog is set when runs aren't worth recording (completion candidates)
+var skipRunLog bool
+
+// getRunsPath returns the run history file path
+func getRunsPath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, RunsFileName), nil
+}
+
+// newRunID returns an ID based on the time, with a random suffix
+func newRunID(now time.Time) string {
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// beginRun starts recording a top-level pipeline run. Nested pipelines,
+// dry runs and command tests aren't recorded separately; it returns nil for them.
+func beginRun(cmd Command, args []string, opts RunOptions) *runRecord {
+	if activeRun != nil || activeTest != nil || opts.DryRun || skipRunLog {
+		return nil
+	}
+
+	now := time.Now()
+	directory, _ := os.Getwd()
+	activeRun = &runRecord{
+		ID:        newRunID(now),
+		Command:   cmd.Name,
+		Args:      args,
+		Source:    cmd.Source,
+		Directory: directory,
+		Status:    RunRunning,
+		Started:   now,
+	}
+	return activeRun
+}
+
+// end finishes the run and appends it to the history
+func (r *runRecord) end(err error) {
+	if r == nil {
+		return
+	}
+	activeRun = nil
+
+	r.Duration = time.Since(r.Started).Milliseconds()
+	r.Status = runStatus(err)
+	if r.Status == RunFailed {
+		r.Error = err.Error()
+	}
+
+	if err := appendRun(r); err != nil {
+		debugLog("Failed to save run history: %v", err)
+	}
+}
+
+// runStatus returns the status of a run that ended with err
+func runStatus(err error) string {
+	switch {
+	case err == nil, errors.Is(err, ErrCommandPrinted):
+		return RunSucceeded
+	case errors.Is(err, ErrCancelled):
+		return RunCancelled
+	case errors.Is(err, ErrInterrupted):
+		return RunInterrupted
+	default:
+		return RunFailed
+	}
+}
+
+// startStep records the start of a step
+func (r *runRecord) startStep(name, stepType string) {
+	if r == nil {
+		return
+	}
+	r.Steps = append(r.Steps, stepRecord{Name: name, Type: stepType, started: time.Now()})
+	r.open = append(r.open, len(r.Steps)-1)
+}
+
+// endStep records the end of the innermost running step
+func (r *runRecord) endStep(err error) {
+	if r == nil || len(r.open) == 0 {
+		return
+	}
+	step := &r.Steps[r.open[len(r.open)-1]]
+	r.open = r.open[:len(r.open)-1]
+
+	step.Duration = time.Since(step.started).Milliseconds()
+	if err != nil {
+		step.Error = err.Error()
+	}
+}
+
+// current returns the innermost running step, or nil
+func (r *runRecord) current() *stepRecord {
+	if r == nil || len(r.open) == 0 {
+		return nil
+	}
+	return &r.Steps[r.open[len(r.open)-1]]
+}
+
+// recordExec records a shell command that ran, with the error it returned
+func (r *runRecord) recordExec(command string, confirmed bool, err error) {
+	if step := r.current(); step != nil {
+		step.Commands = append(step.Commands, commandRecord{Command: command, Confirmed: confirmed, ExitCode: exitCode(err)})
+	}
+}
+
+// setTranscript links the current agentic step to its transcript
+func (r *runRecord) setTranscript(id string) {
+	if step := r.current(); step != nil {
+		step.Transcript = id
+	}
+}
+
+// addUsage adds the tokens used by a model response
+func (r *runRecord) addUsage(usage TokenUsage) {
+	if r == nil {
+		return
+	}
+	r.Usage.InputTokens += usage.InputTokens
+	r.Usage.OutputTokens += usage.OutputTokens
+	r.Usage.CacheCreationTokens += usage.CacheCreationTokens
+	r.Usage.CacheReadTokens += usage.CacheReadTokens
+}
+
+// exitCode returns the exit code of a command that returned err
+func exitCode(err error) int {
+	var exitErr exitCoder
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	default:
+		return -1
+	}
+}
+
+// stepType returns the type of a step
+func stepType(step Step) string {
+	switch {
+	case step.Exec != nil:
+		return "exec"
+	case step.LLM != nil:
+		return "llm"
+	case step.Agentic != nil:
+		return "agentic"
+	case step.Subcommand != nil:
+		return "subcommand"
+	default:
+		return ""
+	}
+}
+
+// appendRun appends a run to the history file
+func appendRun(r *runRecord) error {
+	path, err := getRunsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), DirPerms); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, ConfigFilePerms)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// LoadRuns reads the run history, oldest first. Unreadable lines are skipped.
+func LoadRuns() ([]*runRecord, error) {
+	path, err := getRunsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []*runRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r runRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		runs = append(runs, &r)
+	}
+	return runs, scanner.Err()
+}
+
+// findRun returns a run from the history by ID
+func findRun(id string) (*runRecord, error) {
+	runs, err := LoadRuns()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range runs {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrRunNotFound, id)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runFilter selects runs to list
+type runFilter struct {
+	Command string
+	Status  string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// RunRuns handles the runs built-in command: list and inspect the run
+// history, rerun a run, or resume an agent that didn't finish
+func RunRuns(providers *Providers, opts RunOptions, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return listRuns(args)
+	}
+
+	switch args[0] {
+	case "show":
+		id := ""
+		if len(args) > 1 {
+			id = args[1]
+		}
+		return showRun(id)
+
+	case "rerun":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: x %s rerun <id>", CmdRuns)
+		}
+		return rerun(providers, args[1], opts)
+
+	case "resume":
+		return resumeAgent(providers, args[1:], opts)
+
+	default:
+		return fmt.Errorf("unknown runs option: %s (use show, rerun or resume)", args[0])
+	}
+}
+
+// listRuns handles: x runs [--command name] [--status s] [--since t] [--until t] [-n limit]
+func listRuns(args []string) error {
+	filter := runFilter{Limit: DefaultRunsLimit}
+
+	for i := 0; i < len(args); i += 2 {
+		flag := args[i]
+		if i+1 >= len(args) {
+			return fmt.Errorf("%s needs a value", flag)
+		}
+		value := args[i+1]
+
+		var err error
+		switch flag {
+		case "--command", "-c":
+			filter.Command = value
+		case "--status", "-s":
+			filter.Status = value
+		case "--since":
+			filter.Since, err = parseRunTime(value)
+		case "--until":
+			filter.Until, err = parseRunTime(value)
+		case "--limit", "-n":
+			filter.Limit, err = strconv.Atoi(value)
+		default:
+			return fmt.Errorf("unknown runs option: %s", flag)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", flag, value)
+		}
+	}
+
+	runs, err := LoadRuns()
+	if err != nil {
+		return err
+	}
+
+	shown := 0
+	for i := len(runs) - 1; i >= 0 && (filter.Limit <= 0 || shown < filter.Limit); i-- {
+		r := runs[i]
+		if !filter.matches(r) {
+			continue
+		}
+		shown++
+
+		line := strings.TrimSpace(r.Command + " " + strings.Join(r.Args, " "))
+		if r.Resume != "" {
+			line = "resume " + r.Resume
+		}
+		fmt.Printf("%-20s  %s  %-11s  %7s  %s\n", r.ID, r.Started.Format(DateTimeFormat), r.Status, formatDuration(r.Duration), truncateText(line, 50))
+	}
+
+	if shown == 0 {
+		fmt.Println("No runs found.")
+	}
+	return nil
+}
+
+// matches reports whether a run passes the filter
+func (f runFilter) matches(r *runRecord) bool {
+	switch {
+	case f.Command != "" && r.Command != f.Command:
+		return false
+	case f.Status != "" && r.Status != f.Status:
+		return false
+	case !f.Since.IsZero() && r.Started.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !r.Started.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// parseRunTime parses a date (2006-01-02), a date and time, or a duration
+// ago (24h, 30m)
+func parseRunTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(DateTimeFormat, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(DateFormat, value, time.Local)
+}
+
+// formatDuration formats milliseconds for display
+func formatDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
+
+// showRun prints a run from the history, or the conversation of an agent
+// transcript. An empty ID shows the most recent run.
+func showRun(id string) error {
+	var r *runRecord
+	if id == "" {
+		runs, err := LoadRuns()
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			return ErrRunNotFound
+		}
+		r = runs[len(runs)-1]
+	} else {
+		var err error
+		if r, err = findRun(id); err != nil {
+			t, terr := LoadAgentTranscript(id)
+			if terr != nil {
+				return err
+			}
+			t.Show()
+			return nil
+		}
+	}
+
+	fmt.Printf(ansiBold+"%s"+ansiReset+"  %s  %s\n", r.ID, strings.TrimSpace(r.Command+" "+strings.Join(r.Args, " ")), r.Status)
+	fmt.Printf(ansiDim+"%s · %s · %s · %s · %d in / %d out tokens"+ansiReset+"\n",
+		r.Started.Format(DateTimeFormat), formatDuration(r.Duration), r.Source, r.Directory, r.Usage.InputTokens, r.Usage.OutputTokens)
+	if r.Error != "" {
+		fmt.Printf(ansiRed+"Error: %s"+ansiReset+"\n", r.Error)
+	}
+
+	fmt.Println()
+	for _, step := range r.Steps {
+		mark := ansiGreen + "✓" + ansiReset
+		if step.Error != "" {
+			mark = ansiRed + "✗" + ansiReset
+		}
+		fmt.Printf("%s %s  %s  %s\n", mark, step.Name, step.Type, formatDuration(step.Duration))
+
+		for _, c := range step.Commands {
+			note := fmt.Sprintf("exit %d", c.ExitCode)
+			if c.Confirmed {
+				note += ", confirmed"
+			}
+			fmt.Printf("    "+ansiDim+"$"+ansiReset+" %s  "+ansiDim+"(%s)"+ansiReset+"\n", c.Command, note)
+		}
+		if step.Transcript != "" {
+			fmt.Printf("    "+ansiDim+"conversation: x %s show %s"+ansiReset+"\n", CmdRuns, step.Transcript)
+		}
+		if step.Error != "" {
+			fmt.Printf("    "+ansiRed+"%s"+ansiReset+"\n", step.Error)
+		}
+	}
+	return nil
+}
+
+// rerun runs a command again with the same arguments, in the directory it ran in
+func rerun(providers *Providers, id string, opts RunOptions) error {
+	r, err := findRun(id)
+	if err != nil {
+		return err
+	}
+	if r.Resume != "" {
+		return fmt.Errorf("run %s resumed an agent; use 'x %s resume %s'", r.ID, CmdRuns, r.Resume)
+	}
+
+	if r.Directory != "" {
+		if err := os.Chdir(r.Directory); err != nil {
+			return fmt.Errorf("can't rerun in %s: %w", r.Directory, err)
+		}
+	}
+
+	config, err := LoadCommandsConfig()
+	if err != nil {
+		return err
+	}
+	cmd, ok := config.Commands[r.Command]
+	if !ok {
+		return fmt.Errorf("command not found: %s", r.Command)
+	}
+
+	fmt.Printf(ansiDim+"Rerunning: x %s"+ansiReset+"\n", strings.TrimSpace(r.Command+" "+strings.Join(r.Args, " ")))
+	_, err = RunPipeline(providers, config, cmd, r.Args, opts, false)
+	return err
+}
+
+// resumeAgent handles: x runs resume [id] [--iterations N] [message...]
+// The ID is a transcript ID, or a run ID to resume the run's last agent.
+func resumeAgent(providers *Providers, args []string, opts RunOptions) error {
+	id := ""
+	iterations := 0
+	var message []string
+
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--iterations" || args[i] == "-n":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s needs a value", args[i])
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid iterations: %s", args[i+1])
+			}
+			iterations = n
+			i++
+		case id == "" && len(message) == 0 && transcriptFor(args[i]) != "":
+			id = transcriptFor(args[i])
+		default:
+			message = append(message, args[i])
+		}
+	}
+
+	t, err := LoadAgentTranscript(id)
+	if err != nil {
+		return err
+	}
+
+	config, err := LoadCommandsConfig()
+	if err != nil {
+		return err
+	}
+
+	if iterations == 0 {
+		iterations = t.MaxIterations
+	}
+
+	// Record the resumed agent in the run history
+	run := beginRun(Command{Name: t.Command}, nil, opts)
+	if run != nil {
+		run.Resume = t.ID
+	}
+	run.startStep(t.Step, "agentic")
+	run.setTranscript(t.ID)
+
+	output, err := t.Resume(providers, config, strings.Join(message, " "), iterations, opts)
+	run.endStep(err)
+	run.end(err)
+	if err != nil {
+		return err
+	}
+
+	if t.Status == AgentCompleted && strings.TrimSpace(output) != "" {
+		fmt.Println()
+		renderMarkdown(output)
+	}
+	return nil
+}
+
+// transcriptFor returns the transcript ID an argument refers to: a transcript
+// ID, or a run ID for the run's last agentic step. It returns "" for neither.
+func transcriptFor(arg string) string {
+	if _, err := LoadAgentTranscript(arg); err == nil && arg != "" {
+		return arg
+	}
+
+	r, err := findRun(arg)
+	if err != nil {
+		return ""
+	}
+	for i := len(r.Steps) - 1; i >= 0; i-- {
+		if r.Steps[i].Transcript != "" {
+			return r.Steps[i].Transcript
+		}
+	}
+	return ""
+}
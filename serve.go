@@ -0,0 +1,482 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serveRun is a command run started through the HTTP API
+type serveRun struct {
+	ID       string     `json:"id"`
+	Command  string     `json:"command"`
+	Args     []string   `json:"args"`
+	Status   string     `json:"status"`
+	Output   string     `json:"output,omitempty"` // Everything the run printed
+	Result   string     `json:"result,omitempty"` // Output of the last step
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	changed chan struct{} // Closed and replaced whenever output or status changes
+}
+
+// finished reports whether the run is over
+func (r *serveRun) finished() bool {
+	return r.Status != RunQueued && r.Status != RunRunning
+}
+
+// appendOutput adds printed output, up to MaxServeOutput
+func (r *serveRun) appendOutput(chunk string) {
+	room := MaxServeOutput - len(r.Output)
+	if room <= 0 {
+		return
+	}
+	if len(chunk) > room {
+		chunk = chunk[:room] + "\n[output truncated]\n"
+	}
+	r.Output += chunk
+}
+
+// httpServer runs commands for local tools over HTTP
+type httpServer struct {
+	providers *Providers
+	config    *CommandsConfig
+	token     string     // Required bearer token
+	loopback  bool       // Listening on a loopback address only
+	options   RunOptions // Options commands run with
+
+	mu    sync.Mutex // Guards runs and their fields
+	runs  map[string]*serveRun
+	order []string // Run IDs, oldest first
+	seq   int
+
+	runMu sync.Mutex // Runs take over stdout, so only one runs at a time
+}
+
+// RunServe handles the serve built-in command
+func RunServe(opts RunOptions, args []string) error {
+	addr := DefaultServeAddr
+	token := os.Getenv(EnvServeToken)
+	allowConfirm := false
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--addr":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--addr needs a value")
+			}
+			addr = args[i+1]
+			i++
+		case "--token":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--token needs a value")
+			}
+			token = args[i+1]
+			i++
+		case "--allow-confirm":
+			allowConfirm = true
+		default:
+			return fmt.Errorf("unknown serve option: %s", args[i])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %w", addr, err)
+	}
+
+	config, err := LoadCommandsConfig()
+	if err != nil {
+		return err
+	}
+
+	// Without a token, any local process or web page could run commands
+	if token == "" {
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		token = hex.EncodeToString(secret)
+		fmt.Fprintf(os.Stderr, "Token: %s (set --token or %s to choose one)\n", token, EnvServeToken)
+	}
+
+	s := &httpServer{
+		providers: loadProviders(opts),
+		config:    config,
+		token:     token,
+		loopback:  isLoopbackHost(host),
+		options:   opts,
+		runs:      make(map[string]*serveRun),
+	}
+
+	// Nobody is at the terminal to answer prompts
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	os.Stdin = devNull
+	unattended = true
+	unattendedApprove = allowConfirm
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /commands", s.handleCommands)
+	mux.HandleFunc("POST /commands/{name}/run", s.handleRun)
+	mux.HandleFunc("GET /runs", s.handleRuns)
+	mux.HandleFunc("GET /runs/{id}", s.handleGetRun)
+	mux.HandleFunc("GET /runs/{id}/events", s.handleEvents)
+
+	fmt.Fprintf(os.Stderr, "Serving %d commands on http://%s\n", len(config.Commands), addr)
+	return http.ListenAndServe(addr, s.authorize(mux))
+}
+
+// authorize rejects requests without the bearer token, and requests from web
+// pages: those with a non-loopback Origin, or a non-loopback Host while
+// listening on loopback (DNS rebinding)
+func (s *httpServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.loopback && !isLoopbackHost(hostWithoutPort(r.Host)) {
+			writeJSONError(w, http.StatusForbidden, "host not allowed: "+r.Host)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !isLoopbackHost(u.Hostname()) {
+				writeJSONError(w, http.StatusForbidden, "origin not allowed: "+origin)
+				return
+			}
+		}
+
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackHost reports whether a host name or IP is this machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// hostWithoutPort returns the host of a Host header
+func hostWithoutPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+// handleCommands lists the available commands, sorted by name
+func (s *httpServer) handleCommands(w http.ResponseWriter, r *http.Request) {
+	type argInfo struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Rest        bool   `json:"rest,omitempty"`
+	}
+	type commandInfo struct {
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+		Args        []argInfo `json:"args"`
+		Source      string    `json:"source"`
+		Confirm     bool      `json:"confirm"` // Asks for confirmation when run
+	}
+
+	commands := []commandInfo{}
+	for name, cmd := range s.config.Commands {
+		info := commandInfo{
+			Name:        name,
+			Description: cmd.Description,
+			Args:        []argInfo{},
+			Source:      cmd.Source,
+			Confirm:     needsConfirm(s.config, cmd, nil),
+		}
+		for _, arg := range cmd.Args {
+			info.Args = append(info.Args, argInfo{Name: arg.Name, Description: arg.Description, Rest: arg.Rest})
+		}
+		commands = append(commands, info)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+
+	writeJSON(w, http.StatusOK, commands)
+}
+
+// handleRun starts a command. The body is {"args": [...]} with positional
+// arguments or {"args": {...}} with named ones. With Accept: text/event-stream
+// the run's events are streamed; otherwise its ID is returned right away.
+func (s *httpServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	cmd, ok := s.config.Commands[name]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown command: "+name)
+		return
+	}
+
+	// Web pages can't send JSON cross-origin without a preflight
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+
+	var body struct {
+		Args json.RawMessage `json:"args"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+	}
+
+	var args []string
+	switch trimmed := strings.TrimSpace(string(body.Args)); {
+	case trimmed == "" || trimmed == "null":
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal(body.Args, &args); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "args must be strings: "+err.Error())
+			return
+		}
+	default:
+		var err error
+		if args, err = commandToolArgs(cmd, body.Args); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	run := s.startRun(name, cmd, args)
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamEvents(w, r, run)
+		return
+	}
+
+	w.Header().Set("Location", "/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, s.snapshot(run))
+}
+
+// handleRuns lists runs, most recent first
+func (s *httpServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	runs := make([]serveRun, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		run := *s.runs[s.order[i]]
+		run.Output = "" // Fetch a run for its output
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// handleGetRun returns a run with its output so far
+func (s *httpServer) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run := s.getRun(r.PathValue("id"))
+	if run == nil {
+		writeJSONError(w, http.StatusNotFound, "unknown run: "+r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.snapshot(run))
+}
+
+// handleEvents streams a run's events, starting with the output so far
+func (s *httpServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	run := s.getRun(r.PathValue("id"))
+	if run == nil {
+		writeJSONError(w, http.StatusNotFound, "unknown run: "+r.PathValue("id"))
+		return
+	}
+	s.streamEvents(w, r, run)
+}
+
+// streamEvents sends server-sent events: "output" with each chunk of
+// output, then "done" with the finished run (without its output)
+func (s *httpServer) streamEvents(w http.ResponseWriter, r *http.Request, run *serveRun) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Run-Id", run.ID)
+	w.WriteHeader(http.StatusOK)
+
+	sent := 0
+	for {
+		s.mu.Lock()
+		chunk := run.Output[sent:]
+		sent = len(run.Output)
+		done := run.finished()
+		final := *run
+		changed := run.changed
+		s.mu.Unlock()
+
+		if chunk != "" {
+			data, _ := json.Marshal(map[string]string{"text": chunk})
+			fmt.Fprintf(w, "event: output\ndata: %s\n\n", data)
+		}
+		if done {
+			final.Output = ""
+			data, _ := json.Marshal(final)
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// startRun queues a run of a command and returns it
+func (s *httpServer) startRun(name string, cmd Command, args []string) *serveRun {
+	if args == nil {
+		args = []string{}
+	}
+
+	s.mu.Lock()
+	s.seq++
+	now := time.Now()
+	run := &serveRun{
+		ID:      fmt.Sprintf("%s-%d", now.Format("20060102-150405"), s.seq),
+		Command: name,
+		Args:    args,
+		Status:  RunQueued,
+		Created: now,
+		changed: make(chan struct{}),
+	}
+	s.runs[run.ID] = run
+	s.order = append(s.order, run.ID)
+
+	// Forget the oldest finished runs
+	for len(s.order) > MaxServeRuns && s.runs[s.order[0]].finished() {
+		delete(s.runs, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.mu.Unlock()
+
+	go s.execute(run, cmd)
+	return run
+}
+
+// execute runs a command, capturing everything it prints as the run's output
+func (s *httpServer) execute(run *serveRun, cmd Command) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	s.update(run, func() { run.Status = RunRunning })
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		s.finish(run, "", err)
+		return
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		buf := make([]byte, 4096)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				chunk := string(buf[:n])
+				s.update(run, func() { run.appendOutput(chunk) })
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var result string
+	var runErr error
+	origStdout, origStderr := os.Stdout, os.Stderr
+	defer func() {
+		os.Stdout, os.Stderr = origStdout, origStderr
+		writer.Close()
+		<-copied
+		reader.Close()
+		s.finish(run, result, runErr)
+	}()
+	os.Stdout, os.Stderr = writer, writer
+
+	result, runErr = RunPipeline(s.providers, s.config, cmd, run.Args, s.options, false)
+}
+
+// finish records the outcome of a run
+func (s *httpServer) finish(run *serveRun, result string, err error) {
+	s.update(run, func() {
+		now := time.Now()
+		run.Finished = &now
+		run.Result = result
+		switch {
+		case errors.Is(err, ErrCancelled):
+			run.Status = RunCancelled
+		case err != nil:
+			run.Status = RunFailed
+			run.Error = err.Error()
+		default:
+			run.Status = RunSucceeded
+		}
+	})
+}
+
+// update changes a run and wakes up anyone streaming its events
+func (s *httpServer) update(run *serveRun, change func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change()
+	close(run.changed)
+	run.changed = make(chan struct{})
+}
+
+// getRun returns a run by ID, or nil
+func (s *httpServer) getRun(id string) *serveRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs[id]
+}
+
+// snapshot copies a run so it can be encoded without holding the lock
+func (s *httpServer) snapshot(run *serveRun) serveRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *run
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes an error as {"error": message}
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -12,12 +12,6 @@ import (
 	"syscall"
 )
 
-// ANSI escape codes
-const (
-	ansiDim   = "\033[2m"
-	ansiReset = "\033[0m"
-)
-
 // RunShellCommand executes a command in the appropriate shell for the OS
 // with terminal connected (interactive mode)
 func RunShellCommand(command string) error {
@@ -48,8 +42,9 @@ func RunShellCommandWithOutput(command string) (string, error) {
 	}
 
 	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
+	events := activeEvents.outputWriter(command)
+	cmd.Stdout = io.MultiWriter(&output, events)
+	cmd.Stderr = io.MultiWriter(&output, events)
 
 	err := cmd.Run()
 	return strings.TrimSpace(output.String()), err
@@ -85,8 +80,9 @@ func RunShellCommandStreaming(command string) (string, error) {
 	dimErr := &dimWriter{w: os.Stderr}
 
 	// Write to both terminal (dimmed) and buffer simultaneously
-	cmd.Stdout = io.MultiWriter(dimOut, &output)
-	cmd.Stderr = io.MultiWriter(dimErr, &output)
+	events := activeEvents.outputWriter(command)
+	cmd.Stdout = io.MultiWriter(dimOut, &output, events)
+	cmd.Stderr = io.MultiWriter(dimErr, &output, events)
 
 	// Handle Ctrl+C gracefully to ensure we reset terminal formatting
 	sigChan := make(chan os.Signal, 1)
@@ -115,6 +111,6 @@ func RunShellCommandStreaming(command string) (string, error) {
 		if cmd.Process != nil {
 			cmd.Process.Kill()
 		}
-		return strings.TrimSpace(output.String()), fmt.Errorf("interrupted")
+		return strings.TrimSpace(output.String()), ErrInterrupted
 	}
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Shell widgets that replace the command line with the command generated for
+// it. The shell command runs with X_PRINT_COMMAND set, so it prints the
+// command instead of asking to run it. %[1]s is the key binding.
+// They also export the last command and its exit status for x fix.
+const (
+	bashWidget = `# x shell integration: type what you want, then press the key
+__x_widget() {
+  [[ -z "$READLINE_LINE" ]] && return
+  local cmd
+  cmd=$(X_PRINT_COMMAND=1 x shell "$READLINE_LINE") || return
+  if [[ -n "$cmd" ]]; then
+    READLINE_LINE=$cmd
+    READLINE_POINT=${#cmd}
+  fi
+}
+bind -x '"%[1]s": __x_widget'
+
+# Remember the last command and its exit status for x fix
+__x_last_command() {
+  local code=$?
+  export X_LAST_STATUS=$code
+  export X_LAST_COMMAND=$(HISTTIMEFORMAT= builtin history 1 | sed 's/^ *[0-9]*[* ] *//')
+}
+PROMPT_COMMAND="__x_last_command${PROMPT_COMMAND:+; $PROMPT_COMMAND}"
+`
+
+	zshWidget = `# x shell integration: type what you want, then press the key
+__x_widget() {
+  [[ -z "$BUFFER" ]] && return
+  local cmd
+  zle -R "Generating..."
+  cmd=$(X_PRINT_COMMAND=1 x shell "$BUFFER" </dev/tty)
+  if [[ -n "$cmd" ]]; then
+    BUFFER=$cmd
+    CURSOR=${#BUFFER}
+  fi
+  zle reset-prompt
+}
+zle -N __x_widget
+bindkey '%[1]s' __x_widget
+
+# Remember the last command and its exit status for x fix
+__x_preexec() { __x_command=$1 }
+__x_precmd() {
+  local code=$?
+  if [[ -n "$__x_command" ]]; then
+    export X_LAST_COMMAND=$__x_command X_LAST_STATUS=$code
+    __x_command=
+  fi
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec __x_preexec
+precmd_functions=(__x_precmd $precmd_functions)
+`
+
+	fishWidget = `# x shell integration: type what you want, then press the key
+function __x_widget
+    set -l query (commandline)
+    test -n "$query"; or return
+    set -l cmd (env X_PRINT_COMMAND=1 x shell $query | string collect)
+    if test -n "$cmd"
+        commandline -r -- $cmd
+        commandline -f end-of-line
+    end
+    commandline -f repaint
+end
+bind %[1]s __x_widget
+
+# Remember the last command and its exit status for x fix
+function __x_postexec --on-event fish_postexec
+    set -l code $status
+    set -gx X_LAST_COMMAND $argv[1]
+    set -gx X_LAST_STATUS $code
+end
+`
+)
+
+// RunShellInit handles: x shell-init bash|zsh|fish [--key ctrl-<letter>]
+// It prints the widget for the shell, to be evaluated in its startup file.
+func RunShellInit(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: x %s bash|zsh|fish [--key ctrl-<letter>]", CmdShellInit)
+	}
+	shell := args[0]
+
+	key := DefaultWidgetKey
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--key":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--key needs a value")
+			}
+			key = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+	}
+
+	letter, ok := strings.CutPrefix(strings.ToLower(key), "ctrl-")
+	if !ok || len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' {
+		return fmt.Errorf("invalid key %q: use ctrl-<letter>, e.g. ctrl-o", key)
+	}
+
+	switch shell {
+	case "bash":
+		fmt.Printf(bashWidget, `\C-`+letter)
+	case "zsh":
+		fmt.Printf(zshWidget, "^"+strings.ToUpper(letter))
+	case "fish":
+		fmt.Printf(fishWidget, `\c`+letter)
+	default:
+		return fmt.Errorf("unsupported shell: %s (use bash, zsh or fish)", shell)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// markdownStream renders LLM text incrementally as it is streamed.
+// On a terminal, text is split into markdown blocks (paragraphs, lists,
+// fenced code blocks) and each block is rendered as soon as it is complete.
+// When stdout is not a terminal, raw text is written through unchanged.
+type markdownStream struct {
+	tty      bool
+	rendered bool            // Whether any block has been rendered yet
+	partial  string          // Incomplete trailing line
+	block    []string        // Complete lines of the current block
+	inFence  bool            // Inside a ``` fenced code block
+	text     strings.Builder // Full text received so far
+}
+
+// newMarkdownStream creates a stream renderer for stdout
+func newMarkdownStream() *markdownStream {
+	return &markdownStream{
+		tty: term.IsTerminal(int(os.Stdout.Fd())),
+	}
+}
+
+// Write consumes a chunk of streamed text
+func (m *markdownStream) Write(chunk string) {
+	m.text.WriteString(chunk)
+
+	if !m.tty {
+		fmt.Print(chunk)
+		return
+	}
+
+	m.partial += chunk
+	for {
+		idx := strings.Index(m.partial, "\n")
+		if idx == -1 {
+			break
+		}
+		line := m.partial[:idx]
+		m.partial = m.partial[idx+1:]
+		m.addLine(line)
+	}
+}
+
+// addLine adds a complete line to the current block, rendering the block
+// when a block boundary is reached
+func (m *markdownStream) addLine(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	if strings.HasPrefix(trimmed, "```") {
+		m.block = append(m.block, line)
+		if m.inFence {
+			// Closing fence ends the block
+			m.inFence = false
+			m.renderBlock()
+		} else {
+			m.inFence = true
+		}
+		return
+	}
+
+	if !m.inFence && trimmed == "" {
+		m.renderBlock()
+		return
+	}
+
+	m.block = append(m.block, line)
+}
+
+// renderBlock renders the buffered block and resets it
+func (m *markdownStream) renderBlock() {
+	if len(m.block) == 0 {
+		return
+	}
+
+	rendered := renderMarkdownString(strings.Join(m.block, "\n"))
+	if m.rendered {
+		// Glamour surrounds every render with blank lines; keep a single
+		// blank line between consecutive blocks
+		rendered = strings.TrimPrefix(rendered, "\n")
+	}
+	fmt.Print(rendered)
+
+	m.rendered = true
+	m.block = nil
+}
+
+// Flush renders any remaining buffered text
+func (m *markdownStream) Flush() {
+	if !m.tty {
+		if m.text.Len() > 0 && !strings.HasSuffix(m.text.String(), "\n") {
+			fmt.Println()
+		}
+		return
+	}
+
+	if m.partial != "" {
+		m.block = append(m.block, m.partial)
+		m.partial = ""
+	}
+	if m.inFence {
+		// Close an unterminated fence (e.g. after an interrupt)
+		m.block = append(m.block, "```")
+		m.inFence = false
+	}
+	m.renderBlock()
+}
+
+// String returns all text received so far
+func (m *markdownStream) String() string {
+	return m.text.String()
+}
+
+// interruptContext returns a context that is cancelled when the user presses Ctrl+C.
+// The returned stop function restores default signal handling.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// printInterrupted prints a notice that streaming was interrupted by the user
+func printInterrupted() {
+	fmt.Print("\n" + ansiYellow + "⚠ Interrupted" + ansiReset + "\n")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestMarkdownStreamPassthrough(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"adds a final newline", []string{"hel", "lo"}, "hello\n"},
+		{"keeps a final newline", []string{"hello\n"}, "hello\n"},
+		{"prints nothing for no text", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &markdownStream{}
+			got := captureStdout(t, func() {
+				for _, chunk := range tt.chunks {
+					m.Write(chunk)
+				}
+				m.Flush()
+			})
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+			if m.String() != strings.Join(tt.chunks, "") {
+				t.Errorf("String() = %q, want %q", m.String(), strings.Join(tt.chunks, ""))
+			}
+		})
+	}
+}
+
+func TestMarkdownStreamBlocks(t *testing.T) {
+	noColor = true
+	defer func() { noColor = false }()
+
+	tests := []struct {
+		name      string
+		chunks    []string
+		before    []string // Rendered before Flush
+		notBefore []string // Still buffered before Flush
+		after     []string // Rendered once flushed
+	}{
+		{
+			name:      "renders a paragraph at a blank line",
+			chunks:    []string{"first para", "graph\n", "\n", "second"},
+			before:    []string{"first paragraph"},
+			notBefore: []string{"second"},
+			after:     []string{"second"},
+		},
+		{
+			name:      "keeps blank lines inside a fence",
+			chunks:    []string{"```\n", "one\n", "\n", "two\n"},
+			notBefore: []string{"one", "two"},
+			after:     []string{"one", "two"},
+		},
+		{
+			name:   "renders a fence when it closes",
+			chunks: []string{"```\none\n```\n", "tail"},
+			before: []string{"one"},
+			after:  []string{"tail"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &markdownStream{tty: true}
+			before := captureStdout(t, func() {
+				for _, chunk := range tt.chunks {
+					m.Write(chunk)
+				}
+			})
+			after := captureStdout(t, m.Flush)
+			for _, want := range tt.before {
+				if !strings.Contains(before, want) {
+					t.Errorf("before flush: %q missing from %q", want, before)
+				}
+			}
+			for _, unwanted := range tt.notBefore {
+				if strings.Contains(before, unwanted) {
+					t.Errorf("before flush: %q rendered early in %q", unwanted, before)
+				}
+			}
+			for _, want := range tt.after {
+				if !strings.Contains(after, want) {
+					t.Errorf("after flush: %q missing from %q", want, after)
+				}
+			}
+			if m.inFence {
+				t.Error("fence still open after Flush")
+			}
+		})
+	}
+}
@@ -3,9 +3,12 @@ package main
 import (
 	_ "embed"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,30 +20,65 @@ var commandsTemplate string
 
 // ExecStep executes a shell command
 type ExecStep struct {
-	Command string `yaml:"command"`         // Default command (used if no OS-specific command matches)
-	Windows string `yaml:"windows"`         // Windows-specific command
-	Darwin  string `yaml:"darwin"`          // macOS-specific command
-	Linux   string `yaml:"linux"`           // Linux-specific command
-	Confirm bool   `yaml:"confirm"`         // Prompt before execution
-	Silent  bool   `yaml:"silent"`          // Don't print output (for intermediate steps)
-	Summary string `yaml:"summary"`         // Optional: description shown before confirm
-	Risk    string `yaml:"risk"`            // Optional: risk level shown before confirm (none/low/medium/high)
-	Safer   string `yaml:"safer"`           // Optional: safer alternative shown for risky commands
+	Command string `yaml:"command"` // Default command (used if no OS-specific command matches)
+	Windows string `yaml:"windows"` // Windows-specific command
+	Darwin  string `yaml:"darwin"`  // macOS-specific command
+	Linux   string `yaml:"linux"`   // Linux-specific command
+	Confirm bool   `yaml:"confirm"` // Prompt before execution
+	Silent  bool   `yaml:"silent"`  // Don't print output (for intermediate steps)
+	Summary string `yaml:"summary"` // Optional: description shown before confirm
+	Risk    string `yaml:"risk"`    // Optional: risk level shown before confirm (none/low/medium/high)
+	Safer   string `yaml:"safer"`   // Optional: safer alternative shown for risky commands
 }
 
 // LLMStep makes a single LLM call
 type LLMStep struct {
-	System string `yaml:"system"`
-	Prompt string `yaml:"prompt"`
-	Silent bool   `yaml:"silent"` // Don't print output (for intermediate steps)
+	System   string `yaml:"system"`
+	Prompt   string `yaml:"prompt"`
+	Silent   bool   `yaml:"silent"`   // Don't print output (for intermediate steps)
+	Provider string `yaml:"provider"` // Optional: named provider from config (default: main provider)
+	Model    string `yaml:"model"`    // Optional: model override
 }
 
 // AgenticStep runs a multi-turn agentic loop
 type AgenticStep struct {
-	System        string `yaml:"system"`
-	Prompt        string `yaml:"prompt"`
-	MaxIterations int    `yaml:"max_iterations"`
-	AutoExecute   bool   `yaml:"auto_execute"` // Auto-execute shell commands without confirmation
+	System        string      `yaml:"system"`
+	Prompt        string      `yaml:"prompt"`
+	MaxIterations int         `yaml:"max_iterations"`
+	AutoExecute   bool        `yaml:"auto_execute"`   // Auto-execute shell commands without confirmation
+	Provider      string      `yaml:"provider"`       // Optional: named provider from config (default: main provider)
+	Model         string      `yaml:"model"`          // Optional: model override
+	Tools         []ToolRef   `yaml:"tools"`          // Optional: tools to offer (default: shell)
+	AllowCommands []string    `yaml:"allow_commands"` // Optional: glob patterns shell commands must match
+	DenyCommands  []string    `yaml:"deny_commands"`  // Optional: glob patterns shell commands must not match
+	MCP           []MCPServer `yaml:"mcp"`            // Optional: MCP servers whose tools to offer
+}
+
+// ToolRef selects a tool for an agentic step: a built-in tool by name
+// (read_file), or a command exposed as a tool ({command: deploy-status})
+type ToolRef struct {
+	Name    string `json:"name,omitempty"`    // Built-in tool name
+	Command string `json:"command,omitempty"` // Command to expose as a tool
+}
+
+// UnmarshalYAML accepts a tool name or a {command: name} mapping
+func (r *ToolRef) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		r.Name = value.Value
+		return nil
+	}
+
+	var ref struct {
+		Command string `yaml:"command"`
+	}
+	if err := value.Decode(&ref); err != nil {
+		return err
+	}
+	if ref.Command == "" {
+		return fmt.Errorf("line %d: a tool must be a built-in tool name or {command: name}", value.Line)
+	}
+	r.Command = ref.Command
+	return nil
 }
 
 // SubcommandStep calls another command
@@ -61,23 +99,31 @@ type Step struct {
 
 // Arg represents a named argument for a command
 type Arg struct {
-	Name        string `yaml:"name"`
-	Description string `yaml:"description"`
-	Rest        bool   `yaml:"rest"` // Capture remaining args as one string
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Rest        bool     `yaml:"rest"`     // Capture remaining args as one string
+	Complete    string   `yaml:"complete"` // Shell completion: files, dirs, choices or command:<name>
+	Choices     []string `yaml:"choices"`  // Values to complete (implies complete: choices)
 }
 
 // Command represents a custom command configuration
 type Command struct {
+	Name        string `yaml:"-"` // Command name (set when loaded)
 	Description string `yaml:"description"`
 	Args        []Arg  `yaml:"args"`
 	Steps       []Step `yaml:"steps"`
 	Source      string `yaml:"-"` // Where this command was loaded from (not in YAML)
 }
 
-// CommandsConfig holds all commands and the default
+// CommandsConfig holds all commands and the default. Commands in a group
+// are named group:command (e.g. db:migrate) and run as x db migrate.
 type CommandsConfig struct {
-	Default  string
-	Commands map[string]Command
+	Default   string
+	Commands  map[string]Command
+	Groups    map[string]string    // Group descriptions
+	MCP       map[string]MCPServer // MCP servers declared under the top-level mcp: key
+	RiskRules []RiskRule           // Rules declared under the top-level risk_rules: key
+	Shadowed  []Command            // Commands hidden by a built-in with the same name
 }
 
 // getCommandsPath returns the global commands config file path
@@ -128,14 +174,15 @@ func findAllLocalCommandsFiles() []string {
 
 // LoadCommandsConfig reads and merges command configurations.
 // Configs are merged with this precedence (later overrides earlier):
-// 1. Built-in commands (shell, new) - always up-to-date
+// 1. Built-in commands (shell, fix, new) - always up-to-date
 // 2. Global commands.yaml
 // 3. Parent xcommands.yaml files (from root to current directory)
 // 4. Local xcommands.yaml (in current directory)
 func LoadCommandsConfig() (*CommandsConfig, error) {
 	config := &CommandsConfig{
-		Default:  "shell",
+		Default:  ShellCommand,
 		Commands: make(map[string]Command),
+		Groups:   make(map[string]string),
 	}
 
 	// Load built-in commands first (always current, can be overridden)
@@ -194,9 +241,26 @@ func LoadCommandsConfig() (*CommandsConfig, error) {
 		}
 	}
 
+	// Built-in commands like chat run before commands are loaded, so a
+	// command with the same name can't be reached
+	for _, name := range slices.Sorted(maps.Keys(config.Commands)) {
+		if IsReservedCommand(name) {
+			config.Shadowed = append(config.Shadowed, config.Commands[name])
+			delete(config.Commands, name)
+		}
+	}
+
+	customRiskRules = config.RiskRules
 	return config, nil
 }
 
+// warnShadowedCommands tells the user about commands hidden by a built-in
+func warnShadowedCommands(config *CommandsConfig) {
+	for _, cmd := range config.Shadowed {
+		fmt.Fprintf(os.Stderr, ansiYellow+"⚠ Command %q from %s is hidden by the built-in 'x %s'; rename it to use it"+ansiReset+"\n", cmd.Name, cmd.Source, cmd.Name)
+	}
+}
+
 // mergeConfig parses YAML data and merges it into the existing config
 func mergeConfig(config *CommandsConfig, data []byte, source string) error {
 	var raw map[string]any
@@ -212,25 +276,161 @@ func mergeConfig(config *CommandsConfig, data []byte, source string) error {
 		delete(raw, "default")
 	}
 
+	// Command tests are loaded separately by LoadCommandTests
+	delete(raw, "tests")
+
+	// Extract MCP servers shared by agentic steps
+	if mcpVal, ok := raw["mcp"]; ok {
+		mcpData, err := yaml.Marshal(mcpVal)
+		if err != nil {
+			return err
+		}
+		var servers []MCPServer
+		if err := yaml.Unmarshal(mcpData, &servers); err != nil {
+			return fmt.Errorf("invalid mcp servers: %w", err)
+		}
+		if config.MCP == nil {
+			config.MCP = make(map[string]MCPServer)
+		}
+		for _, server := range servers {
+			config.MCP[server.Name] = server
+		}
+		delete(raw, "mcp")
+	}
+
+	// Extract risk rules; a rule replaces an earlier one with the same name
+	if rulesVal, ok := raw["risk_rules"]; ok {
+		rulesData, err := yaml.Marshal(rulesVal)
+		if err != nil {
+			return err
+		}
+		var rules []RiskRule
+		if err := yaml.Unmarshal(rulesData, &rules); err != nil {
+			return fmt.Errorf("invalid risk rules: %w", err)
+		}
+		for _, rule := range rules {
+			if err := rule.compile(); err != nil {
+				return &ConfigError{Err: err}
+			}
+			config.RiskRules = slices.DeleteFunc(config.RiskRules, func(r RiskRule) bool { return r.Name == rule.Name })
+			config.RiskRules = append(config.RiskRules, rule)
+		}
+		delete(raw, "risk_rules")
+	}
+
 	// Parse and merge commands
 	for name, value := range raw {
-		valueData, err := yaml.Marshal(value)
-		if err != nil {
-			continue
+		if err := mergeCommand(config, name, value, source); err != nil {
+			return err
 		}
+	}
 
-		var cmd Command
-		if err := yaml.Unmarshal(valueData, &cmd); err != nil {
-			continue
+	return nil
+}
+
+// mergeCommand merges a command, or a group with its commands under a
+// commands: key. Groups merge across files: each file can add commands to
+// the same group.
+func mergeCommand(config *CommandsConfig, name string, value any, source string) error {
+	if group, ok := value.(map[string]any); ok && group["commands"] != nil {
+		if _, ok := group["steps"]; ok {
+			return fmt.Errorf("%s: a group has commands instead of steps", name)
+		}
+		commands, ok := group["commands"].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: commands must map names to commands", name)
+		}
+		if description, ok := group["description"].(string); ok && description != "" {
+			if config.Groups == nil {
+				config.Groups = make(map[string]string)
+			}
+			config.Groups[name] = description
+		}
+		for sub, subValue := range commands {
+			if err := mergeCommand(config, name+GroupSeparator+sub, subValue, source); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
 
-		cmd.Source = source
-		config.Commands[name] = cmd
+	valueData, err := yaml.Marshal(value)
+	if err != nil {
+		return nil
 	}
 
+	var cmd Command
+	if err := yaml.Unmarshal(valueData, &cmd); err != nil {
+		return nil
+	}
+
+	cmd.Name = name
+	cmd.Source = source
+	config.Commands[name] = cmd
 	return nil
 }
 
+// FindCommand finds the command named by the first args, following groups:
+// "db migrate" and "db:migrate" both name db:migrate. It returns the name
+// and the args after it. The name is a group's if the args stop at one.
+func (c *CommandsConfig) FindCommand(args []string) (string, []string) {
+	name, rest := args[0], args[1:]
+	for len(rest) > 0 && c.IsGroup(name) {
+		next := name + GroupSeparator + rest[0]
+		if _, ok := c.Commands[next]; !ok && !c.IsGroup(next) {
+			break
+		}
+		name, rest = next, rest[1:]
+	}
+	return name, rest
+}
+
+// IsGroup reports whether name is a group with commands in it
+func (c *CommandsConfig) IsGroup(name string) bool {
+	return c.groupSize(name) > 0
+}
+
+// groupSize returns how many commands are in a group, including its subgroups
+func (c *CommandsConfig) groupSize(group string) int {
+	count := 0
+	for name := range c.Commands {
+		if strings.HasPrefix(name, group+GroupSeparator) {
+			count++
+		}
+	}
+	return count
+}
+
+// groupEntries returns the full names of the commands and subgroups directly
+// in a group, sorted. The empty group is the top level.
+func (c *CommandsConfig) groupEntries(group string) (commands, groups []string) {
+	prefix := ""
+	if group != "" {
+		prefix = group + GroupSeparator
+	}
+	for name := range c.Commands {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if sub, _, nested := strings.Cut(rest, GroupSeparator); nested {
+			if !slices.Contains(groups, prefix+sub) {
+				groups = append(groups, prefix+sub)
+			}
+		} else {
+			commands = append(commands, name)
+		}
+	}
+	sort.Strings(commands)
+	sort.Strings(groups)
+	return commands, groups
+}
+
+// displayName returns a command's name as it's typed: db migrate for db:migrate
+func displayName(name string) string {
+	return strings.ReplaceAll(name, GroupSeparator, " ")
+}
+
 // LoadCommands reads and parses the commands configuration (legacy compatibility)
 func LoadCommands() (map[string]Command, error) {
 	config, err := LoadCommandsConfig()
@@ -263,7 +463,7 @@ func EnsureCommandsFile() (string, error) {
 // IsReservedCommand checks if a command name is reserved
 func IsReservedCommand(name string) bool {
 	switch name {
-	case CmdConfigure, CmdCommands, CmdUsage, CmdUpgrade, CmdVersion:
+	case CmdConfigure, CmdCommands, CmdUsage, CmdUpgrade, CmdVersion, CmdChat, CmdMCP, CmdServe, CmdRuns, CmdHistory, CmdShellInit, CmdCompletion, CmdComplete, CmdExplain:
 		return true
 	default:
 		return false
@@ -272,20 +472,40 @@ func IsReservedCommand(name string) bool {
 
 // PrintHelp prints the main help message with all available commands
 func PrintHelp(config *CommandsConfig) {
-	fmt.Println("Usage: x <command> [args]")
+	fmt.Println("Usage: x [flags] <command> [args]")
 	fmt.Println()
 	fmt.Println("Built-in commands:")
-	fmt.Println("  configure   Configure authentication")
-	fmt.Println("  commands    Edit custom commands")
+	fmt.Println("  configure   Configure the LLM provider ('configure <name>' adds a named one)")
+	fmt.Println("  chat        Start an interactive chat (--resume to continue)")
+	fmt.Println("  commands    Edit custom commands ('commands test [name]' runs their tests)")
+	fmt.Println("  explain     Explain a shell command part by part, with its risk (--run to run it)")
+	fmt.Println("  history     Search commands generated by shell and run one again")
+	fmt.Println("  shell-init  Print a bash, zsh or fish widget that puts generated commands on the prompt")
+	fmt.Println("  completion  Print a bash, zsh, fish or powershell completion script")
+	fmt.Println("  runs        List past runs ('runs show|rerun|resume <id>' to inspect, repeat or continue one)")
+	fmt.Println("  mcp serve   Serve your commands as tools to MCP clients over stdio")
+	fmt.Println("  serve       Serve an HTTP API for running commands (--addr, --token)")
 	fmt.Println("  usage       Show token usage and cost")
 	fmt.Println("  upgrade     Upgrade to latest version")
 	fmt.Println("  version     Show current version")
 	fmt.Println()
+	fmt.Println("Global flags (before the command):")
+	fmt.Println("  --dry-run       Show what would run without running anything")
+	fmt.Println("  --debug         Print prompts and step details")
+	fmt.Println("  --model <name>  Use this model for every LLM call")
+	fmt.Println("  -q, --quiet     Don't show commands and tool calls as they run")
+	fmt.Println("  --json          Print the result as a JSON object on stdout")
+	fmt.Println("  --output <fmt>  text, json, or jsonl for a JSON event per line")
+	fmt.Println("  -y, --yes       Run commands without asking for confirmation")
+	fmt.Println("  --no-input      Never ask: fail if a command needs confirmation")
+	fmt.Println()
 
-	if len(config.Commands) > 0 {
-		// Group commands by source
+	commands, groups := config.groupEntries("")
+	if len(commands) > 0 {
+		// Group commands by source; commands in groups are listed by 'x <group>'
 		bySource := make(map[string][]string)
-		for name, cmd := range config.Commands {
+		for _, name := range commands {
+			cmd := config.Commands[name]
 			bySource[cmd.Source] = append(bySource[cmd.Source], name)
 		}
 
@@ -296,10 +516,10 @@ func PrintHelp(config *CommandsConfig) {
 		}
 		sort.Slice(sources, func(i, j int) bool {
 			// built-in comes first
-			if sources[i] == "built-in" {
+			if sources[i] == BuiltinSource {
 				return true
 			}
-			if sources[j] == "built-in" {
+			if sources[j] == BuiltinSource {
 				return false
 			}
 			// global comes second
@@ -312,9 +532,9 @@ func PrintHelp(config *CommandsConfig) {
 			return sources[i] < sources[j]
 		})
 
-		// Find max name length across all commands for alignment
+		// Find max name length across all commands and groups for alignment
 		maxLen := 0
-		for name := range config.Commands {
+		for _, name := range append(commands, groups...) {
 			if len(name) > maxLen {
 				maxLen = len(name)
 			}
@@ -342,9 +562,69 @@ func PrintHelp(config *CommandsConfig) {
 			}
 			fmt.Println()
 		}
+
+		if len(groups) > 0 {
+			fmt.Println("Command groups:")
+			printGroups(config, groups, maxLen)
+			fmt.Println()
+		}
 	}
 
-	fmt.Println("Run 'x <command> --help' for command-specific help.")
+	fmt.Println("Run 'x <command> --help' for command-specific help, or 'x <group>' to list a group's commands.")
+}
+
+// PrintGroupHelp lists the commands and subgroups in a group
+func PrintGroupHelp(config *CommandsConfig, group string) {
+	desc := config.Groups[group]
+	if desc == "" {
+		desc = "(no description)"
+	}
+	fmt.Printf("%s: %s\n", displayName(group), desc)
+
+	commands, groups := config.groupEntries(group)
+	maxLen := 0
+	for _, name := range append(commands, groups...) {
+		if n := len(name) - len(group) - 1; n > maxLen {
+			maxLen = n
+		}
+	}
+
+	if len(commands) > 0 {
+		fmt.Println()
+		fmt.Println("Commands:")
+		for _, name := range commands {
+			cmd := config.Commands[name]
+			cmdDesc := cmd.Description
+			if cmdDesc == "" {
+				cmdDesc = "(no description)"
+			}
+			fmt.Printf("  %-*s  %s\n", maxLen, name[len(group)+1:], cmdDesc)
+		}
+	}
+	if len(groups) > 0 {
+		fmt.Println()
+		fmt.Println("Groups:")
+		printGroups(config, groups, maxLen)
+	}
+
+	fmt.Println()
+	fmt.Printf("Run 'x %s <command> --help' for command-specific help.\n", displayName(group))
+}
+
+// printGroups prints a line for each group, by its last name segment
+func printGroups(config *CommandsConfig, groups []string, width int) {
+	for _, group := range groups {
+		desc := config.Groups[group]
+		if desc == "" {
+			desc = "(no description)"
+		}
+		short := group[strings.LastIndex(group, GroupSeparator)+1:]
+		count := fmt.Sprintf("%d commands", config.groupSize(group))
+		if config.groupSize(group) == 1 {
+			count = "1 command"
+		}
+		fmt.Printf("  %-*s  %s (%s)\n", width, short, desc, count)
+	}
 }
 
 // PrintCommandHelp prints help for a specific command
@@ -353,7 +633,7 @@ func PrintCommandHelp(name string, cmd Command) {
 	if desc == "" {
 		desc = "(no description)"
 	}
-	fmt.Printf("%s: %s\n", name, desc)
+	fmt.Printf("%s: %s\n", displayName(name), desc)
 
 	if len(cmd.Args) > 0 {
 		fmt.Println()
@@ -382,7 +662,7 @@ func PrintCommandHelp(name string, cmd Command) {
 
 	// Show usage example
 	fmt.Println()
-	fmt.Printf("Usage: x %s", name)
+	fmt.Printf("Usage: x %s", displayName(name))
 	for _, arg := range cmd.Args {
 		if arg.Rest {
 			fmt.Printf(" <%s>...", arg.Name)
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMergeCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		wantSources map[string]string // Command -> file it came from
+		wantGroups  map[string]string
+		wantErr     bool
+	}{
+		{
+			name:        "top-level command",
+			files:       []string{"hi:\n  steps:\n    - exec: {command: echo hi}\n"},
+			wantSources: map[string]string{"hi": "file1"},
+		},
+		{
+			name: "group",
+			files: []string{`db:
+  description: Database tasks
+  commands:
+    migrate:
+      steps: [{exec: {command: migrate}}]
+    schema:
+      commands:
+        dump:
+          steps: [{exec: {command: dump}}]
+`},
+			wantSources: map[string]string{"db:migrate": "file1", "db:schema:dump": "file1"},
+			wantGroups:  map[string]string{"db": "Database tasks"},
+		},
+		{
+			name: "groups merge across files",
+			files: []string{
+				"db:\n  commands:\n    migrate:\n      steps: [{exec: {command: a}}]\n    seed:\n      steps: [{exec: {command: b}}]\n",
+				"db:\n  commands:\n    seed:\n      steps: [{exec: {command: c}}]\n    reset:\n      steps: [{exec: {command: d}}]\n",
+			},
+			wantSources: map[string]string{"db:migrate": "file1", "db:seed": "file2", "db:reset": "file2"},
+		},
+		{
+			name:        "full name at the top level",
+			files:       []string{"db:migrate:\n  steps: [{exec: {command: a}}]\n"},
+			wantSources: map[string]string{"db:migrate": "file1"},
+		},
+		{
+			name:    "group with steps",
+			files:   []string{"db:\n  steps: [{exec: {command: a}}]\n  commands:\n    migrate:\n      steps: [{exec: {command: b}}]\n"},
+			wantErr: true,
+		},
+		{
+			name:    "commands that aren't a map",
+			files:   []string{"db:\n  commands: [migrate]\n"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &CommandsConfig{Commands: make(map[string]Command)}
+			var err error
+			for i, file := range tt.files {
+				if err = mergeConfig(config, []byte(file), fmt.Sprintf("file%d", i+1)); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			sources := make(map[string]string)
+			for name, cmd := range config.Commands {
+				sources[name] = cmd.Source
+				if cmd.Name != name {
+					t.Errorf("command %s has name %q", name, cmd.Name)
+				}
+			}
+			if !maps.Equal(sources, tt.wantSources) {
+				t.Errorf("commands = %v, want %v", sources, tt.wantSources)
+			}
+			if !maps.Equal(config.Groups, tt.wantGroups) {
+				t.Errorf("groups = %v, want %v", config.Groups, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	config := &CommandsConfig{Commands: make(map[string]Command)}
+	for _, name := range []string{"deploy", "db:migrate", "db:seed", "db:schema:dump"} {
+		config.Commands[name] = Command{Name: name}
+	}
+
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{[]string{"deploy", "staging"}, "deploy", []string{"staging"}},
+		{[]string{"db", "migrate", "up"}, "db:migrate", []string{"up"}},
+		{[]string{"db:migrate", "up"}, "db:migrate", []string{"up"}},
+		{[]string{"db", "schema", "dump"}, "db:schema:dump", []string{}},
+		{[]string{"db"}, "db", []string{}},
+		{[]string{"db", "schema"}, "db:schema", []string{}},
+		{[]string{"db", "--help"}, "db", []string{"--help"}},
+		{[]string{"db", "why", "is", "it", "slow"}, "db", []string{"why", "is", "it", "slow"}},
+		{[]string{"list", "my", "files"}, "list", []string{"my", "files"}},
+		{[]string{"deploy", "db", "migrate"}, "deploy", []string{"db", "migrate"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			name, args := config.FindCommand(tt.args)
+			if name != tt.wantName || !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("FindCommand(%q) = %q, %q, want %q, %q", tt.args, name, args, tt.wantName, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestIsGroup(t *testing.T) {
+	config := &CommandsConfig{Commands: make(map[string]Command)}
+	for _, name := range []string{"deploy", "db:migrate", "db:schema:dump"} {
+		config.Commands[name] = Command{Name: name}
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"db", true},
+		{"db:schema", true},
+		{"deploy", false},
+		{"db:migrate", false},
+		{"list", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.IsGroup(tt.name); got != tt.want {
+				t.Errorf("IsGroup(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCommandsConfigShadowed(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	local := "chat:\n  steps: [{exec: {command: a}}]\ndeploy:\n  steps: [{exec: {command: b}}]\n"
+	if err := os.WriteFile(LocalCommandsFileName, []byte(local), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadCommandsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Commands["chat"]; ok {
+		t.Error("chat is still listed as a command")
+	}
+	if _, ok := config.Commands["deploy"]; !ok {
+		t.Error("deploy is missing")
+	}
+	if len(config.Shadowed) != 1 || config.Shadowed[0].Name != "chat" {
+		t.Errorf("Shadowed = %v, want the chat command", config.Shadowed)
+	}
+}
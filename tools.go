@@ -1,27 +1,27 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-
-	"github.com/anthropics/anthropic-sdk-go"
+	"regexp"
+	"strings"
 )
 
 // GetShellTool returns the shell command execution tool definition
-func GetShellTool() anthropic.ToolUnionParam {
+func GetShellTool() ToolDef {
 	tv := GetTemplateValues()
 
-	tool := anthropic.ToolUnionParamOfTool(
-		anthropic.ToolInputSchemaParam{
-			Properties: map[string]any{
-				"command": map[string]any{
-					"type":        "string",
-					"description": "The shell command to execute",
-				},
+	tool := ToolDef{
+		Name: ToolShell,
+		Properties: map[string]any{
+			"command": map[string]any{
+				"type":        "string",
+				"description": "The shell command to execute",
 			},
-			Required: []string{"command"},
 		},
-		ToolShell,
-	)
+		Required: []string{"command"},
+	}
 
 	description := fmt.Sprintf(`Execute a shell command and return the output.
 
@@ -39,36 +39,304 @@ What the user sees:
 
 Since command output is hidden from the user, summarize important results in your responses.`, tv.OS, tv.Arch, tv.Shell, tv.Directory, tv.User)
 
-	tool.OfTool.Description = anthropic.String(description)
+	tool.Description = description
 	return tool
 }
 
 // GetCompleteTool returns the completion signal tool definition
-func GetCompleteTool() anthropic.ToolUnionParam {
-	tool := anthropic.ToolUnionParamOfTool(
-		anthropic.ToolInputSchemaParam{
-			Properties: map[string]any{
-				"output": map[string]any{
-					"type":        "string",
-					"description": "The final output or result of the task",
-				},
+func GetCompleteTool() ToolDef {
+	tool := ToolDef{
+		Name: ToolComplete,
+		Properties: map[string]any{
+			"output": map[string]any{
+				"type":        "string",
+				"description": "The final output or result of the task",
 			},
-			Required: []string{"output"},
 		},
-		ToolComplete,
-	)
-	tool.OfTool.Description = anthropic.String(`Signal that the workflow is complete. Call this when you have finished the task.
+		Required: []string{"output"},
+	}
+	tool.Description = `Signal that the workflow is complete. Call this when you have finished the task.
 
 The output you provide here becomes the result of this step and may be passed to subsequent steps in the pipeline. Provide the actual output/result, not a description of what you did.
 
-Communicate progress and explanations in your text responses BEFORE calling this.`)
+Communicate progress and explanations in your text responses BEFORE calling this.`
 	return tool
 }
 
-// BuildAgenticTools returns the tool list for agentic steps
-func BuildAgenticTools() []anthropic.ToolUnionParam {
-	return []anthropic.ToolUnionParam{
-		GetShellTool(),
-		GetCompleteTool(),
+// toolContext holds the settings of the agentic step running a tool
+type toolContext struct {
+	providers     *Providers
+	config        *CommandsConfig  // Commands, for command tools
+	autoExecute   bool             // Run commands and apply file changes without confirmation
+	allowCommands []commandPattern // Patterns shell commands must match (empty allows all)
+	denyCommands  []commandPattern // Patterns shell commands must not match
+	options       RunOptions       // Options for command tools' pipelines
+	stopErr       error            // Set by a tool to end the agent's run, e.g. ErrNoInput
+}
+
+// toolHandler runs a tool call and returns the result and whether it is an error
+type toolHandler func(tc *toolContext, input json.RawMessage) (string, bool)
+
+// agentTool is a tool definition with its handler
+type agentTool struct {
+	Def    ToolDef
+	Handle toolHandler // nil for complete, which the agentic loop handles itself
+}
+
+// builtinTools returns all built-in tools in the order they are offered
+func builtinTools() []agentTool {
+	return []agentTool{
+		{GetShellTool(), handleShellTool},
+		{GetReadFileTool(), handleReadFile},
+		{GetWriteFileTool(), handleWriteFile},
+		{GetEditFileTool(), handleEditFile},
+		{GetListDirTool(), handleListDir},
+		{GetGlobTool(), handleGlob},
+		{GetGrepTool(), handleGrep},
+		{GetAskUserTool(), handleAskUser},
+		{GetCompleteTool(), nil},
+	}
+}
+
+// BuildAgenticTools returns the tools for an agentic step. refs selects
+// built-in tools and commands to expose as tools (shell when empty);
+// complete is always included so the step can finish.
+func BuildAgenticTools(refs []ToolRef, config *CommandsConfig) ([]agentTool, error) {
+	all := builtinTools()
+	if len(refs) == 0 {
+		refs = []ToolRef{{Name: ToolShell}}
+	}
+
+	byName := make(map[string]agentTool, len(all))
+	for _, tool := range all {
+		byName[tool.Def.Name] = tool
+	}
+
+	var tools []agentTool
+	hasComplete := false
+	for _, ref := range refs {
+		if ref.Command != "" {
+			cmd, ok := config.Commands[ref.Command]
+			if !ok {
+				return nil, fmt.Errorf("%w: command %s", ErrUnknownTool, ref.Command)
+			}
+			tool := commandTool(ref.Command, cmd)
+			if _, ok := byName[tool.Def.Name]; ok {
+				return nil, fmt.Errorf("command %s conflicts with the built-in tool of the same name", ref.Command)
+			}
+			tools = append(tools, tool)
+			continue
+		}
+
+		tool, ok := byName[ref.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s (available: %s)", ErrUnknownTool, ref.Name, strings.Join(toolNames(all), ", "))
+		}
+		tools = append(tools, tool)
+		hasComplete = hasComplete || ref.Name == ToolComplete
+	}
+	if !hasComplete {
+		tools = append(tools, byName[ToolComplete])
+	}
+
+	return tools, nil
+}
+
+// invalidToolNameChars matches characters not allowed in tool names
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// commandTool exposes a command as a tool. Its arguments become string
+// parameters, and it runs with captured output, which is the tool result.
+func commandTool(name string, cmd Command) agentTool {
+	handle := func(tc *toolContext, input json.RawMessage) (string, bool) {
+		args, err := commandToolArgs(cmd, input)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), true
+		}
+
+		printToolAction("Running", strings.TrimSpace("x "+name+" "+strings.Join(args, " ")))
+		output, err := RunPipeline(tc.providers, tc.config, cmd, args, tc.options, true)
+		if errors.Is(err, ErrNoInput) {
+			tc.stopErr = err
+		}
+		if errors.Is(err, ErrCancelled) {
+			return "The user cancelled the command.", false
+		}
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), true
+		}
+		if strings.TrimSpace(output) == "" {
+			return "(no output)", false
+		}
+		return output, false
+	}
+
+	return agentTool{Def: commandToolDef(name, cmd), Handle: handle}
+}
+
+// commandToolDef describes a command as a tool
+func commandToolDef(name string, cmd Command) ToolDef {
+	properties := make(map[string]any, len(cmd.Args))
+	var required []string
+	for _, arg := range cmd.Args {
+		properties[arg.Name] = map[string]any{
+			"type":        "string",
+			"description": arg.Description,
+		}
+		required = append(required, arg.Name)
+	}
+
+	description := cmd.Description
+	if description == "" {
+		description = fmt.Sprintf("Run the %s command", name)
+	}
+
+	return ToolDef{
+		Name:        invalidToolNameChars.ReplaceAllString(name, "_"),
+		Description: description,
+		Properties:  properties,
+		Required:    required,
+	}
+}
+
+// commandToolArgs converts the input of a command tool call to command arguments
+func commandToolArgs(cmd Command, input json.RawMessage) ([]string, error) {
+	var params map[string]any
+	if err := json.Unmarshal(input, &params); err != nil {
+		return nil, fmt.Errorf("parsing tool input: %w", err)
+	}
+
+	var args []string
+	for _, arg := range cmd.Args {
+		value, ok := params[arg.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing argument %s", arg.Name)
+		}
+		if s, ok := value.(string); ok {
+			args = append(args, s)
+		} else {
+			data, _ := json.Marshal(value)
+			args = append(args, string(data))
+		}
+	}
+	return args, nil
+}
+
+// checkCommand returns an error if a shell command is not allowed by the
+// step's allow_commands and deny_commands. Each part of a compound command
+// (separated by ;, &&, ||, |, & or a newline) is checked on its own.
+func (tc *toolContext) checkCommand(command string) error {
+	if len(tc.allowCommands) == 0 && len(tc.denyCommands) == 0 {
+		return nil
+	}
+
+	// Substituted commands and redirections can't be checked, so an allow
+	// list rules them out
+	if len(tc.allowCommands) > 0 {
+		switch {
+		case commandSubstitution.MatchString(command):
+			return fmt.Errorf("command substitution is not allowed in this step")
+		case strings.ContainsAny(command, "<>"):
+			return fmt.Errorf("redirection is not allowed in this step")
+		}
+	}
+
+	for _, part := range commandSeparators.Split(command, -1) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if pattern, ok := matchCommandPattern(tc.denyCommands, part); ok {
+			return fmt.Errorf("%q matches deny_commands pattern %q", part, pattern)
+		}
+		if len(tc.allowCommands) > 0 {
+			if _, ok := matchCommandPattern(tc.allowCommands, part); !ok {
+				return fmt.Errorf("%q doesn't match any allow_commands pattern (%s)", part, strings.Join(patternGlobs(tc.allowCommands), ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// commandSeparators splits compound shell commands into simple commands
+var commandSeparators = regexp.MustCompile(`&&|\|\||[;|&\n]`)
+
+// commandSubstitution matches command and process substitution
+var commandSubstitution = regexp.MustCompile("`|\\$\\(|<\\(|>\\(")
+
+// commandPattern is an allow_commands or deny_commands glob and its regexp
+type commandPattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// compileCommandPatterns compiles allow_commands or deny_commands globs.
+// * matches any text (including spaces and slashes) and ? any single character.
+func compileCommandPatterns(globs []string) []commandPattern {
+	patterns := make([]commandPattern, 0, len(globs))
+	for _, glob := range globs {
+		var re strings.Builder
+		re.WriteString("^")
+		for _, c := range glob {
+			switch c {
+			case '*':
+				re.WriteString(".*")
+			case '?':
+				re.WriteString(".")
+			default:
+				re.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		re.WriteString("$")
+		patterns = append(patterns, commandPattern{glob: glob, re: regexp.MustCompile(re.String())})
+	}
+	return patterns
+}
+
+// matchCommandPattern returns the first glob pattern matching a command
+func matchCommandPattern(patterns []commandPattern, command string) (string, bool) {
+	for _, pattern := range patterns {
+		if pattern.re.MatchString(command) {
+			return pattern.glob, true
+		}
+	}
+	return "", false
+}
+
+// patternGlobs returns the globs of compiled command patterns
+func patternGlobs(patterns []commandPattern) []string {
+	globs := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		globs = append(globs, pattern.glob)
+	}
+	return globs
+}
+
+// toolDefs returns the definitions of a tool list
+func toolDefs(tools []agentTool) []ToolDef {
+	defs := make([]ToolDef, 0, len(tools))
+	for _, tool := range tools {
+		defs = append(defs, tool.Def)
+	}
+	return defs
+}
+
+// toolNames returns the names of a tool list
+func toolNames(tools []agentTool) []string {
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Def.Name)
+	}
+	return names
+}
+
+// findTool returns the handler for a tool name
+func findTool(tools []agentTool, name string) (toolHandler, bool) {
+	for _, tool := range tools {
+		if tool.Def.Name == name && tool.Handle != nil {
+			return tool.Handle, true
+		}
 	}
+	return nil, false
 }
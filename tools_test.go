@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestCheckCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		command string
+		wantErr bool
+	}{
+		{"no lists", nil, nil, "rm -rf build", false},
+		{"allowed", []string{"git *"}, nil, "git status", false},
+		{"not allowed", []string{"git *"}, nil, "ls", true},
+		{"every part allowed", []string{"git *", "ls*"}, nil, "git status && ls -la", false},
+		{"chained after &&", []string{"git *"}, nil, "git status && rm -rf /", true},
+		{"chained after ;", []string{"git *"}, nil, "git status; rm -rf /", true},
+		{"chained after ||", []string{"git *"}, nil, "git status || rm -rf /", true},
+		{"piped", []string{"git *"}, nil, "git log | sh", true},
+		{"backgrounded", []string{"git *"}, nil, "git fetch & rm -rf /", true},
+		{"on a new line", []string{"git *"}, nil, "git status\nrm -rf /", true},
+		{"command substitution", []string{"echo *"}, nil, "echo $(rm -rf /)", true},
+		{"backticks", []string{"echo *"}, nil, "echo `rm -rf /`", true},
+		{"process substitution", []string{"diff *"}, nil, "diff <(ls a) <(ls b)", true},
+		{"redirection", []string{"echo *"}, nil, "echo hi > ~/.bashrc", true},
+		{"input redirection", []string{"cat *"}, nil, "cat < /etc/passwd", true},
+		{"denied", nil, []string{"rm *"}, "rm -rf build", true},
+		{"denied part", nil, []string{"rm *"}, "ls && rm -rf build", true},
+		{"not denied", nil, []string{"rm *"}, "ls -la", false},
+		{"substitution without an allow list", nil, []string{"rm *"}, "echo $(date)", false},
+		{"deny wins over allow", []string{"*"}, []string{"git push*"}, "git push --force", true},
+		{"? matches one character", []string{"ls -?"}, nil, "ls -l", false},
+		{"? doesn't match two", []string{"ls -?"}, nil, "ls -la", true},
+		{"glob characters are literal", []string{"echo a.b"}, nil, "echo axb", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &toolContext{
+				allowCommands: compileCommandPatterns(tt.allow),
+				denyCommands:  compileCommandPatterns(tt.deny),
+			}
+			err := tc.checkCommand(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkCommand(%q) error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Agent transcript statuses
+const (
+	AgentRunning       = "running"
+	AgentCompleted     = "completed"      // Called the complete tool
+	AgentStopped       = "stopped"        // Stopped without calling complete
+	AgentMaxIterations = "max_iterations" // Ran out of iterations
+	AgentInterrupted   = "interrupted"    // Ctrl+C
+	AgentFailed        = "failed"         // Provider error
+)
+
+// AgentTranscript is the saved conversation of an agentic step, with what's
+// needed to resume it
+type AgentTranscript struct {
+	ID         string     `json:"id"`
+	Run        string     `json:"run,omitempty"` // ID of the run in the run history
+	Command    string     `json:"command"`
+	Step       string     `json:"step"` // Step name, e.g. fix.agent
+	Directory  string     `json:"directory"`
+	Status     string     `json:"status"`
+	Output     string     `json:"output,omitempty"`
+	Iterations int        `json:"iterations"`
+	Usage      TokenUsage `json:"usage"`
+	Created    time.Time  `json:"created"`
+	Updated    time.Time  `json:"updated"`
+
+	// Step settings used when resuming
+	Provider      string      `json:"provider,omitempty"`
+	Model         string      `json:"model,omitempty"`
+	MaxIterations int         `json:"max_iterations"`
+	AutoExecute   bool        `json:"auto_execute,omitempty"`
+	Tools         []ToolRef   `json:"tools,omitempty"`
+	AllowCommands []string    `json:"allow_commands,omitempty"`
+	DenyCommands  []string    `json:"deny_commands,omitempty"`
+	MCP           []MCPServer `json:"mcp,omitempty"`
+
+	System   string    `json:"system"`
+	Messages []Message `json:"messages"`
+}
+
+// getTranscriptsDir returns the directory where agent transcripts are stored
+func getTranscriptsDir() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, TranscriptsDirName), nil
+}
+
+// newAgentTranscript starts the transcript of an agentic step
+func newAgentTranscript(ctx *PipelineContext, step *AgenticStep, servers []MCPServer, model, systemPrompt, prompt string) *AgentTranscript {
+	now := time.Now()
+	directory, _ := os.Getwd()
+
+	if step.Model != "" {
+		model = step.Model
+	}
+	maxIterations := step.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxIterations
+	}
+
+	// Name the transcript after the run it belongs to
+	base := now.Format("20060102-150405")
+	runID := ""
+	if activeRun != nil {
+		runID = activeRun.ID
+		base = runID + "-" + ctx.StepID
+	}
+
+	return &AgentTranscript{
+		ID:            newTranscriptID(base),
+		Run:           runID,
+		Command:       ctx.Command,
+		Step:          ctx.stepName(),
+		Directory:     directory,
+		Created:       now,
+		Updated:       now,
+		Provider:      step.Provider,
+		Model:         model,
+		MaxIterations: maxIterations,
+		AutoExecute:   step.AutoExecute,
+		Tools:         step.Tools,
+		AllowCommands: step.AllowCommands,
+		DenyCommands:  step.DenyCommands,
+		MCP:           servers,
+		System:        systemPrompt,
+		Messages:      []Message{NewTextMessage(RoleUser, prompt)},
+	}
+}
+
+// newTranscriptID returns base, or base with a number added if it's taken
+func newTranscriptID(base string) string {
+	id := base
+	dir, err := getTranscriptsDir()
+	if err != nil {
+		return id
+	}
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, id+".json")); os.IsNotExist(err) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// addUsage adds the tokens used by a response
+func (t *AgentTranscript) addUsage(usage TokenUsage) {
+	t.Usage.InputTokens += usage.InputTokens
+	t.Usage.OutputTokens += usage.OutputTokens
+	t.Usage.CacheCreationTokens += usage.CacheCreationTokens
+	t.Usage.CacheReadTokens += usage.CacheReadTokens
+}
+
+// finish records how the agent ended and saves the transcript
+func (t *AgentTranscript) finish(status, output string) {
+	t.Status = status
+	t.Output = output
+	t.save()
+}
+
+// save writes the transcript to disk. Transcripts aren't kept for command tests,
+// and failing to save one doesn't stop the agent.
+func (t *AgentTranscript) save() {
+	if activeTest != nil {
+		return
+	}
+	if err := t.write(); err != nil {
+		debugLog("Failed to save transcript: %v", err)
+	}
+}
+
+// write writes the transcript to disk
+func (t *AgentTranscript) write() error {
+	dir, err := getTranscriptsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, DirPerms); err != nil {
+		return err
+	}
+
+	t.Updated = time.Now()
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, t.ID+".json"), data, ConfigFilePerms)
+}
+
+// printResumeHint tells the user how to continue an unfinished agent
+func (t *AgentTranscript) printResumeHint() {
+	if activeTest != nil {
+		return
+	}
+	fmt.Printf(ansiDim+"Continue with: x %s resume %s"+ansiReset+"\n", CmdRuns, t.ID)
+}
+
+// LoadAgentTranscript reads a transcript by ID. An empty ID loads the most recent one.
+func LoadAgentTranscript(id string) (*AgentTranscript, error) {
+	dir, err := getTranscriptsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if id == "" {
+		transcripts, err := ListAgentTranscripts()
+		if err != nil {
+			return nil, err
+		}
+		if len(transcripts) == 0 {
+			return nil, ErrTranscriptNotFound
+		}
+		return transcripts[0], nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrTranscriptNotFound, id)
+		}
+		return nil, err
+	}
+
+	var t AgentTranscript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid transcript %s: %w", id, err)
+	}
+	return &t, nil
+}
+
+// ListAgentTranscripts returns saved transcripts, most recently updated first
+func ListAgentTranscripts() ([]*AgentTranscript, error) {
+	dir, err := getTranscriptsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var transcripts []*AgentTranscript
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		t, err := LoadAgentTranscript(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		transcripts = append(transcripts, t)
+	}
+
+	sort.Slice(transcripts, func(i, j int) bool {
+		return transcripts[i].Updated.After(transcripts[j].Updated)
+	})
+	return transcripts, nil
+}
+
+// Resume continues an unfinished agent for up to maxIterations more
+// iterations. An optional message from the user is added first.
+func (t *AgentTranscript) Resume(providers *Providers, config *CommandsConfig, message string, maxIterations int, opts RunOptions) (string, error) {
+	if t.Status == AgentCompleted {
+		return "", fmt.Errorf("agent %s already completed", t.ID)
+	}
+	fmt.Printf(ansiDim+"Resuming %s (%s, %d iterations so far)"+ansiReset+"\n", t.ID, t.Step, t.Iterations)
+	if cwd, _ := os.Getwd(); t.Directory != "" && cwd != t.Directory {
+		fmt.Printf(ansiYellow+"⚠ This agent ran in %s"+ansiReset+"\n", t.Directory)
+	}
+
+	// The conversation must end with a user turn, which gets the message
+	if len(t.Messages) == 0 || t.Messages[len(t.Messages)-1].Role == RoleAssistant {
+		if message == "" {
+			message = "Continue."
+		}
+		t.Messages = append(t.Messages, NewTextMessage(RoleUser, message))
+	} else if message != "" {
+		last := &t.Messages[len(t.Messages)-1]
+		last.Content = append(last.Content, ContentBlock{Type: BlockText, Text: message})
+	}
+
+	tools, err := BuildAgenticTools(t.Tools, config)
+	if err != nil {
+		return "", err
+	}
+
+	provider, err := providers.ForStep(t.Step, t.Provider, t.Model)
+	if err != nil {
+		return "", err
+	}
+
+	if len(t.MCP) > 0 {
+		var stopServers func()
+		tools, stopServers, err = startMCPTools(t.MCP, tools)
+		if err != nil {
+			return "", err
+		}
+		defer stopServers()
+	}
+
+	tc := &toolContext{
+		providers:     providers,
+		config:        config,
+		autoExecute:   t.AutoExecute,
+		allowCommands: compileCommandPatterns(t.AllowCommands),
+		denyCommands:  compileCommandPatterns(t.DenyCommands),
+		options:       opts,
+	}
+	return runAgentLoop(provider, tools, tc, t, maxIterations)
+}
+
+// Show re-renders the conversation
+func (t *AgentTranscript) Show() {
+	fmt.Printf(ansiBold+"%s"+ansiReset+"  %s  %s\n", t.ID, t.Step, t.Status)
+	fmt.Printf(ansiDim+"%s · %s · %d iterations · %d in / %d out tokens"+ansiReset+"\n",
+		t.Updated.Format(DateTimeFormat), t.Model, t.Iterations, t.Usage.InputTokens, t.Usage.OutputTokens)
+
+	for i, msg := range t.Messages {
+		for _, block := range msg.Content {
+			switch block.Type {
+			case BlockText:
+				if msg.Role == RoleUser {
+					label := "Prompt"
+					if i > 0 {
+						label = "User"
+					}
+					fmt.Printf("\n"+ansiBoldCyan+"› %s:"+ansiReset+" %s\n", label, block.Text)
+				} else {
+					fmt.Println()
+					renderMarkdown(block.Text)
+				}
+
+			case BlockToolUse:
+				printToolAction(block.ToolName, compactJSON(block.Input))
+
+			case BlockToolResult:
+				text := block.Text
+				lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+				if len(lines) > ShowResultLines {
+					text = strings.Join(lines[:ShowResultLines], "\n") + fmt.Sprintf("\n... (%d more lines)", len(lines)-ShowResultLines)
+				}
+				color := ansiDim
+				if block.IsError {
+					color = ansiRed
+				}
+				fmt.Println(color + text + ansiReset)
+			}
+		}
+	}
+
+	if t.Status == AgentCompleted && t.Output != "" {
+		fmt.Print("\n" + ansiBoldGreen + "✓ Output:" + ansiReset + "\n")
+		renderMarkdown(t.Output)
+	}
+}
+
+// compactJSON returns JSON on a single line, or the input unchanged if it isn't valid
+func compactJSON(data json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}